@@ -1,9 +1,11 @@
 package logic
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"sort"
+	"sync"
 
 	"github.com/kevwan/chatbot/bot/adapters/storage"
 	"github.com/kevwan/chatbot/bot/nlp"
@@ -11,29 +13,45 @@ import (
 )
 
 const (
-	chunkSize     = 10000
-	topAnswerSize = 10
+	chunkSize   = 10000
+	blendWeight = 0.5
+	// followUpThreshold is the minimum similarity to a trained follow-up
+	followUpThreshold = 0.5
+	// followUpBoost moves the confidence of a follow-up towards 1
+	followUpBoost = 0.5
+)
+
+const (
+	// RankBySimilarity scores candidates by the edit distance similarity.
+	RankBySimilarity Ranking = iota
+	// RankByBM25 scores candidates by BM25 on the segmented terms.
+	RankByBM25
+	// RankByBlend scores candidates by blending BM25 and the similarity.
+	RankByBlend
 )
 
 type (
+	// Ranking is the way to score the candidates found in the storage.
+	Ranking int
+
 	sourceAndTargets struct {
 		source  string
+		matcher *nlp.SimilarityMatcher
 		targets []string
+		// the terms are only segmented if ranking with BM25
+		terms       *nlp.Terms
+		sourceTerms []string
+		targetTerms [][]string
+		avgLength   float64
+		maxBM25     float64
 	}
 
 	questionAndScore struct {
 		question string
 		score    float32
-	}
-
-	answerAndOccurrence struct {
-		question string
-		answer     string
-		occurrence int
-	}
-
-	topOccurAnswers struct {
-		answers []*answerAndOccurrence
+		// the components of the score, by the ranking
+		bm25       float32
+		similarity float32
 	}
 
 	topScoreQuestions struct {
@@ -41,9 +59,20 @@ type (
 	}
 
 	closestMatch struct {
-		verbose bool
-		storage storage.StorageAdapter
-		tops    int
+		verbose   bool
+		storage   storage.StorageAdapter
+		tops      int
+		ranking   Ranking
+		termsLock sync.RWMutex
+		terms     *nlp.Terms
+		feedback  *FeedbackSet
+	}
+
+	// TermsAdapter is a LogicAdapter which can switch to other terms, like the
+	// terms of the uploaded dictionaries.
+	TermsAdapter interface {
+		LogicAdapter
+		SetTerms(terms *nlp.Terms)
 	}
 )
 
@@ -51,6 +80,55 @@ func NewClosestMatch(storage storage.StorageAdapter, tops int) LogicAdapter {
 	return &closestMatch{
 		storage: storage,
 		tops:    tops,
+		ranking: RankBySimilarity,
+	}
+}
+
+// NewRankedClosestMatch returns a closest match which ranks the candidates by
+// the given ranking, terms are required unless ranking by similarity.
+func NewRankedClosestMatch(storage storage.StorageAdapter, tops int, ranking Ranking,
+	terms *nlp.Terms) (LogicAdapter, error) {
+	if ranking != RankBySimilarity && terms == nil {
+		return nil, errors.New("terms are required to rank by BM25")
+	}
+
+	return &closestMatch{
+		storage: storage,
+		tops:    tops,
+		ranking: ranking,
+		terms:   terms,
+	}, nil
+}
+
+// SetTerms gives the terms to the match if it's a TermsAdapter.
+func SetTerms(match LogicAdapter, terms *nlp.Terms) {
+	if adapter, ok := match.(TermsAdapter); ok {
+		adapter.SetTerms(terms)
+	}
+}
+
+func (ranking Ranking) String() string {
+	switch ranking {
+	case RankByBM25:
+		return "bm25"
+	case RankByBlend:
+		return "blend"
+	default:
+		return "similarity"
+	}
+}
+
+// ParseRanking parses the name of a ranking, similarity, bm25 or blend.
+func ParseRanking(name string) (Ranking, error) {
+	switch name {
+	case "", "similarity":
+		return RankBySimilarity, nil
+	case "bm25":
+		return RankByBM25, nil
+	case "blend":
+		return RankByBlend, nil
+	default:
+		return RankBySimilarity, fmt.Errorf("unknown ranking: %s", name)
 	}
 }
 
@@ -59,129 +137,267 @@ func (match *closestMatch) CanProcess(string) bool {
 }
 
 func (match *closestMatch) Process(text string) []Answer {
+	answers, _ := match.process(text, nil)
+	return answers
+}
+
+// ProcessWithHistory also answers with the follow-ups of the last sentence in
+// the history, the sentences that followed it in the trained conversations,
+// if the text is similar to them. The confidences of the follow-ups are
+// boosted, so that they win over the matches out of the context.
+func (match *closestMatch) ProcessWithHistory(text string, history []string) []Answer {
+	return match.ProcessWithTrace(text, history, nil)
+}
+
+// ProcessWithTrace is ProcessWithHistory that explains the search and the
+// scores of the candidates into trace, if not nil.
+func (match *closestMatch) ProcessWithTrace(text string, history []string, trace *Trace) []Answer {
+	answers, note := match.process(text, trace)
+	answers = match.processFollowUps(text, history, answers)
+	trace.addStep("closest", answers, note)
+	return answers
+}
+
+// process answers the text, the note tells how the answers are found.
+func (match *closestMatch) process(text string, trace *Trace) ([]Answer, string) {
 	if responses, ok := match.storage.Find(text); ok {
-		return match.processExactMatch(responses)
-	} else {
-		return match.processSimilarMatch(text)
+		return match.processExactMatch(text, responses), "the question is stored as is"
 	}
-}
 
-func (match *closestMatch) SetVerbose() {
-	match.verbose = true
+	// the users confirmed the question to be a stored one by their feedback
+	if question, ok := match.feedback.Associated(text); ok {
+		if responses, ok := match.storage.Find(question); ok {
+			return match.processExactMatch(question, responses),
+				fmt.Sprintf("the question is confirmed by feedback to be %s", question)
+		}
+	}
+
+	answers := match.processSimilarMatch(text, trace)
+	var candidates int
+	if trace != nil && trace.Search != nil {
+		candidates = len(trace.Search.Candidates)
+	}
+	return answers, fmt.Sprintf("the most similar of %d candidates by %s", candidates, match.ranking)
 }
 
-func (match *closestMatch) processExactMatch(responses map[string]int) []Answer {
-	var top topOccurAnswers
+// processFollowUps adds the follow-ups of the last sentence in the history to
+// the answers.
+func (match *closestMatch) processFollowUps(text string, history []string, answers []Answer) []Answer {
+	if len(history) == 0 {
+		return answers
+	}
 
-	for key, occurrence := range responses {
-		top.put(key, occurrence)
+	followUps, ok := match.storage.Find(history[len(history)-1])
+	if !ok {
+		return answers
 	}
 
-	sort.Slice(top.answers, func(i, j int) bool {
-		return top.answers[i].occurrence > top.answers[j].occurrence
+	var contextual []Answer
+	for _, followUp := range followUps {
+		similarity := nlp.SimilarityForStrings(text, followUp.Answer)
+		if similarity < followUpThreshold {
+			continue
+		}
+
+		responses, ok := match.storage.Find(followUp.Answer)
+		if !ok || len(responses) == 0 {
+			continue
+		}
+
+		confidence := similarity + (1-similarity)*followUpBoost
+		answer := newAnswer(followUp.Answer, topResponses(responses, 1)[0], confidence, "closest")
+		answer.Scores = map[string]float32{
+			"similarity": similarity,
+			"history":    confidence,
+		}
+		contextual = append(contextual, answer)
+	}
+	if match.verbose {
+		fmt.Println("follow-ups matched:", len(contextual))
+	}
+	if len(contextual) == 0 {
+		return answers
+	}
+
+	for _, answer := range answers {
+		duplicate := false
+		for _, each := range contextual {
+			if each.Content == answer.Content {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			contextual = append(contextual, answer)
+		}
+	}
+	sort.SliceStable(contextual, func(i, j int) bool {
+		return contextual[i].Confidence > contextual[j].Confidence
 	})
+	if len(contextual) > match.tops {
+		contextual = contextual[:match.tops]
+	}
+
+	return contextual
+}
 
-	tops := match.tops
-	if len(top.answers) < tops {
-		tops = len(top.answers)
+// SetTerms replaces the terms to rank by BM25 with, which are not used if
+// ranking by similarity.
+func (match *closestMatch) SetTerms(terms *nlp.Terms) {
+	if match.ranking == RankBySimilarity || terms == nil {
+		return
 	}
 
-	answers := make([]Answer, tops)
-	for i := 0; i < tops; i++ {
-		answers[i].Content = top.answers[i].answer
-		answers[i].Confidence = 1
+	match.termsLock.Lock()
+	match.terms = terms
+	match.termsLock.Unlock()
+}
+
+// SetFeedback reranks the similar questions by the feedback on their answers,
+// and answers the questions confirmed by the feedback as the stored ones.
+func (match *closestMatch) SetFeedback(feedback *FeedbackSet) {
+	match.feedback = feedback
+}
+
+func (match *closestMatch) SetVerbose() {
+	match.verbose = true
+}
+
+func (match *closestMatch) processExactMatch(text string, responses []storage.Response) []Answer {
+	responses = topResponses(responses, match.tops)
+	answers := make([]Answer, len(responses))
+	for i, response := range responses {
+		answers[i] = newAnswer(text, response, 1, "closest")
 	}
 
 	return answers
 }
 
-func (match *closestMatch) processSimilarMatch(text string) []Answer {
-	result, err := mr.MapReduce(generator(match, text), mapper(match), reducer(match))
-	if err != nil{
+// processSimilarMatch answers with the candidates most similar to the text,
+// more candidates are kept to trace than to answer, and to rerank by the
+// feedback.
+func (match *closestMatch) processSimilarMatch(text string, trace *Trace) []Answer {
+	candidates := match.tops
+	if match.feedback.enabled() {
+		candidates *= feedbackCandidates
+	}
+	tops := candidates
+	if trace != nil && tops < maxTracedCandidates {
+		tops = maxTracedCandidates
+	}
+	result, err := mr.MapReduce(generator(match, text, trace), mapper(match, tops), reducer(tops))
+	if err != nil {
 		return nil
 	}
 
 	var answers []Answer
 	slice := result.([]questionAndScore)
+	if trace != nil {
+		var scored []questionAndScore
+		for _, each := range slice {
+			if each.score > 0 {
+				scored = append(scored, each)
+			}
+		}
+		trace.addCandidates(scored, match.scores)
+	}
+	if len(slice) > candidates {
+		slice = slice[:candidates]
+	}
 	for _, each := range slice {
 		if each.score > 0 {
-			if responses, ok := match.storage.Find(each.question); ok {
-				matches := match.processExactMatch(responses)
-				if len(matches) > 0 {
-					answers = append(answers, Answer{
-						Content:    matches[0].Content,
-						Confidence: each.score,
-					})
-				}
+			if responses, ok := match.storage.Find(each.question); ok && len(responses) > 0 {
+				answer := newAnswer(each.question, topResponses(responses, 1)[0], each.score, "closest")
+				answer.Scores = match.scores(each)
+				answers = append(answers, answer)
 			}
 		}
 	}
 
+	answers = match.feedback.rerank(answers)
+	if len(answers) > match.tops {
+		answers = answers[:match.tops]
+	}
+
 	return answers
 }
 
-func (top *topOccurAnswers) put(answer string, occurrence int) {
-	if len(top.answers) < topAnswerSize {
-		top.answers = append(top.answers, &answerAndOccurrence{
-			answer:     answer,
-			occurrence: occurrence,
-		})
-	} else {
-		var leastIndex int
-		leastOccurrence := math.MaxInt32
-
-		for i, each := range top.answers {
-			if each.occurrence < leastOccurrence {
-				leastOccurrence = each.occurrence
-				leastIndex = i
-			}
+func generator(match *closestMatch, text string, trace *Trace) mr.GenerateFunc {
+	return func(source chan<- interface{}) {
+		keys := storage.SearchWithTrace(match.storage, text, trace.searchTrace())
+		if match.verbose {
+			printMatches(keys)
 		}
 
-		if leastOccurrence < occurrence {
-			top.answers[leastIndex] = &answerAndOccurrence{
-				answer:     answer,
-				occurrence: occurrence,
-			}
+		if len(keys) == 0 {
+			return
 		}
-	}
-}
 
-func generator(match *closestMatch, text string) mr.GenerateFunc {
-	return func(source chan<- interface{}) {
-		keys := match.storage.Search(text)
-		if match.verbose {
-			printMatches(keys)
+		// the matcher is read only, shared by the mappers
+		matcher := nlp.NewSimilarityMatcher(text)
+		if match.ranking == RankBySimilarity {
+			chunks := splitStrings(keys, chunkSize)
+			for _, chunk := range chunks {
+				source <- sourceAndTargets{
+					source:  text,
+					matcher: matcher,
+					targets: chunk,
+				}
+			}
+			return
 		}
 
-		chunks := splitStrings(keys, chunkSize)
-		for _, chunk := range chunks {
+		// BM25 needs the average length of the candidates, segment them upfront
+		match.termsLock.RLock()
+		terms := match.terms
+		match.termsLock.RUnlock()
+		sourceTerms := terms.Cut(text)
+		targetTerms := make([][]string, len(keys))
+		var total int
+		for i := range keys {
+			targetTerms[i] = terms.Cut(keys[i])
+			total += len(targetTerms[i])
+		}
+		avgLength := float64(total) / float64(len(keys))
+		// the best possible score is to have all the terms of the question
+		maxBM25 := nlp.DefaultBM25.Score(sourceTerms, sourceTerms, avgLength, terms.Idf)
+
+		for i := 0; i < len(keys); i += chunkSize {
+			end := i + chunkSize
+			if end > len(keys) {
+				end = len(keys)
+			}
 			source <- sourceAndTargets{
-				source:  text,
-				targets: chunk,
+				source:      text,
+				matcher:     matcher,
+				targets:     keys[i:end],
+				terms:       terms,
+				sourceTerms: sourceTerms,
+				targetTerms: targetTerms[i:end],
+				avgLength:   avgLength,
+				maxBM25:     maxBM25,
 			}
 		}
 	}
 }
 
-func mapper(match *closestMatch) mr.MapperFunc {
+func mapper(match *closestMatch, n int) mr.MapperFunc {
 	return func(data interface{}, writer mr.Writer, cancel func(error)) {
-		tops := newTopScoreQuestions(match.tops)
+		tops := newTopScoreQuestions(n)
 		pair := data.(sourceAndTargets)
 		for i := range pair.targets {
-			score := nlp.SimilarityForStrings(pair.source, pair.targets[i])
-			tops.add(questionAndScore{
-				question: pair.targets[i],
-				score:    score,
-			})
+			if score, ok := match.score(pair, i, tops.min()); ok {
+				tops.add(score)
+			}
 		}
 
 		writer.Write(tops)
 	}
 }
 
-func reducer(match *closestMatch) mr.ReducerFunc {
+func reducer(n int) mr.ReducerFunc {
 	return func(input <-chan interface{}, writer mr.Writer, cancel func(error)) {
-		tops := newTopScoreQuestions(match.tops)
+		tops := newTopScoreQuestions(n)
 		for each := range input {
 			qs := each.(*topScoreQuestions)
 			for _, question := range qs.questions {
@@ -197,6 +413,64 @@ func reducer(match *closestMatch) mr.ReducerFunc {
 	}
 }
 
+// score scores the i-th target, the scoring stops early if the target can't
+// score above min.
+func (match *closestMatch) score(pair sourceAndTargets, i int, min float32) (questionAndScore, bool) {
+	result := questionAndScore{
+		question: pair.targets[i],
+	}
+
+	var ok bool
+	switch match.ranking {
+	case RankByBM25:
+		result.bm25 = pair.bm25(i)
+		result.score = result.bm25
+		ok = result.score > min
+	case RankByBlend:
+		result.bm25 = pair.bm25(i)
+		// the similarity it takes for the blended score to be above min
+		minSimilarity := (min - blendWeight*result.bm25) / (1 - blendWeight)
+		if result.similarity, ok = pair.matcher.SimilarityAbove(pair.targets[i], minSimilarity); ok {
+			result.score = blendWeight*result.bm25 + (1-blendWeight)*result.similarity
+			ok = result.score > min
+		}
+	default:
+		result.similarity, ok = pair.matcher.SimilarityAbove(pair.targets[i], min)
+		result.score = result.similarity
+	}
+
+	return result, ok
+}
+
+// scores returns the breakdown of the score by the ranking.
+func (match *closestMatch) scores(question questionAndScore) map[string]float32 {
+	switch match.ranking {
+	case RankByBM25:
+		return map[string]float32{
+			"bm25": question.bm25,
+		}
+	case RankByBlend:
+		return map[string]float32{
+			"bm25":       question.bm25,
+			"similarity": question.similarity,
+		}
+	default:
+		return map[string]float32{
+			"similarity": question.similarity,
+		}
+	}
+}
+
+// bm25 returns the BM25 score of the i-th target normalized into [0, 1].
+func (pair sourceAndTargets) bm25(i int) float32 {
+	if pair.maxBM25 <= 0 {
+		return 0
+	}
+
+	score := nlp.DefaultBM25.Score(pair.sourceTerms, pair.targetTerms[i], pair.avgLength, pair.terms.Idf)
+	return float32(math.Min(score/pair.maxBM25, 1))
+}
+
 func splitStrings(slice []string, size int) [][]string {
 	var result [][]string
 	count := len(slice)
@@ -230,6 +504,19 @@ func newTopScoreQuestions(n int) *topScoreQuestions {
 	}
 }
 
+// min returns the lowest score of the top questions, the questions need to
+// score above it to make the top.
+func (tq *topScoreQuestions) min() float32 {
+	var score float32 = 1
+	for _, each := range tq.questions {
+		if each.score < score {
+			score = each.score
+		}
+	}
+
+	return score
+}
+
 func (tq *topScoreQuestions) add(q questionAndScore) {
 	var score float32 = 1
 	var index int
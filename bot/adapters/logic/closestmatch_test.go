@@ -0,0 +1,177 @@
+package logic
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/kevwan/chatbot/bot/nlp"
+)
+
+func TestClosestMatchRanking(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"dict.txt":       "重启 100 v\n",
+		"idf.txt":        "restart 1\nserver 3\nlog 2\n",
+		"stop_words.txt": "的\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	terms, err := nlp.LoadTerms(filepath.Join(dir, "dict.txt"), filepath.Join(dir, "idf.txt"),
+		filepath.Join(dir, "stop_words.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := stubStorage{
+		"restart server": {{Answer: "server", CorpusId: 1, Occurrence: 1}},
+		"restart log":    {{Answer: "log", CorpusId: 2, Occurrence: 1}},
+	}
+	const question = "server restart"
+	// both candidates have 2 terms, so the BM25 of each matched term is its
+	// IDF, normalized by the IDFs of the question, restart 1 and server 3
+	bm25 := map[string]float32{
+		"restart server": 1,
+		"restart log":    0.25,
+	}
+	matcher := nlp.NewSimilarityMatcher(question)
+
+	// the characters of restart log are more similar to the question, but
+	// its terms are less relevant
+	for ranking, top := range map[Ranking]string{
+		RankBySimilarity: "restart log",
+		RankByBM25:       "restart server",
+		RankByBlend:      "restart server",
+	} {
+		ranking, top := ranking, top
+		t.Run(ranking.String(), func(t *testing.T) {
+			match, err := NewRankedClosestMatch(store, 2, ranking, terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			answers := match.Process(question)
+			if len(answers) != 2 || answers[0].Question != top {
+				t.Fatalf("expected both questions, %s first, got %v", top, answers)
+			}
+			for _, answer := range answers {
+				similarity := matcher.Similarity(answer.Question)
+				var expect float32
+				switch ranking {
+				case RankByBM25:
+					expect = bm25[answer.Question]
+				case RankByBlend:
+					expect = blendWeight*bm25[answer.Question] + (1-blendWeight)*similarity
+				default:
+					expect = similarity
+				}
+				if math.Abs(float64(answer.Confidence-expect)) > 1e-6 {
+					t.Fatalf("%s: expected confidence %v, got %v", answer.Question, expect, answer.Confidence)
+				}
+			}
+		})
+	}
+
+	// the terms of new dictionaries reach the match through the combo
+	if err := ioutil.WriteFile(filepath.Join(dir, "idf.txt"), []byte("restart 3\nserver 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := nlp.LoadTerms(filepath.Join(dir, "dict.txt"), filepath.Join(dir, "idf.txt"),
+		filepath.Join(dir, "stop_words.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, err := NewRankedClosestMatch(store, 2, RankByBM25, terms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTerms(NewComboMatch(match), reloaded)
+	answers := match.Process(question)
+	if len(answers) != 2 || answers[1].Question != "restart log" || answers[1].Confidence != 0.75 {
+		t.Fatalf("expected restart log scored by the new IDFs, got %v", answers)
+	}
+
+	if _, err := NewRankedClosestMatch(store, 2, RankByBM25, nil); err == nil {
+		t.Fatal("expected error ranking by BM25 without terms")
+	}
+	if ranking, err := ParseRanking("blend"); err != nil || ranking != RankByBlend {
+		t.Fatalf("expected blend ranking, got %v, %v", ranking, err)
+	}
+	if _, err := ParseRanking("unknown"); err == nil {
+		t.Fatal("expected error on unknown ranking")
+	}
+}
+
+func TestClosestMatchFollowUps(t *testing.T) {
+	// the trained conversation, each sentence is stored with the next one
+	store := stubStorage{
+		"how do i deploy":             {{Answer: "which environment", Occurrence: 1}},
+		"which environment":           {{Answer: "production", Occurrence: 1}},
+		"production":                  {{Answer: "run the release pipeline", Occurrence: 1}},
+		"production servers are down": {{Answer: "call the on duty", Occurrence: 1}},
+	}
+	match := NewClosestMatch(store, 1).(*closestMatch)
+
+	tests := []struct {
+		name     string
+		text     string
+		history  []string
+		expect   string
+		followUp bool
+	}{
+		{
+			name:     "the follow-up of the last answer",
+			text:     "production",
+			history:  []string{"how do i deploy", "which environment"},
+			expect:   "run the release pipeline",
+			followUp: true,
+		},
+		{
+			name:     "similar to the follow-up",
+			text:     "the production",
+			history:  []string{"how do i deploy", "which environment"},
+			expect:   "run the release pipeline",
+			followUp: true,
+		},
+		{
+			name:   "no history",
+			text:   "production servers down",
+			expect: "call the on duty",
+		},
+		{
+			name:    "not similar to the follow-up",
+			text:    "production servers down",
+			history: []string{"how do i deploy", "which environment"},
+			expect:  "call the on duty",
+		},
+		{
+			name:    "the last sentence without follow-ups",
+			text:    "production servers down",
+			history: []string{"unknown"},
+			expect:  "call the on duty",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			answers := match.ProcessWithHistory(test.text, test.history)
+			if len(answers) != 1 || answers[0].Content != test.expect {
+				t.Fatalf("expected %s, got %v", test.expect, answers)
+			}
+			if _, ok := answers[0].Scores["history"]; ok != test.followUp {
+				t.Fatalf("expected answered by the follow-ups %t, got %v", test.followUp, answers)
+			}
+		})
+	}
+
+	// the confidence of a follow-up is boosted towards 1
+	answers := match.ProcessWithHistory("the production", []string{"which environment"})
+	similarity := answers[0].Scores["similarity"]
+	if expect := similarity + (1-similarity)*followUpBoost; answers[0].Confidence != expect {
+		t.Fatalf("expected the confidence %v boosted from %v, got %v", expect, similarity, answers[0].Confidence)
+	}
+}
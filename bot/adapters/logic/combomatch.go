@@ -1,8 +1,48 @@
 package logic
 
-type comboMatch struct {
-	matches []LogicAdapter
-}
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/kevwan/chatbot/bot/nlp"
+)
+
+const (
+	// FirstMatch answers with the first adapter that can process the question.
+	FirstMatch ComboStrategy = iota
+	// FirstAboveThreshold answers with the first adapter that gives an answer
+	// with at least the minimum confidence.
+	FirstAboveThreshold
+	// MergeByConfidence merges the answers of all the adapters, and reranks
+	// them by their best confidence.
+	MergeByConfidence
+	// WeightedVote scores each answer by the weighted sum of the confidences
+	// the adapters give it, divided by the sum of the weights of the adapters
+	// that give any answers. The confidences are kept in the scores of the
+	// answer by the adapters.
+	WeightedVote
+)
+
+type (
+	// ComboStrategy is the way to combine the answers of the adapters.
+	ComboStrategy int
+
+	// ComboConfig configures a combo match, Weights are the weights of the
+	// matches to vote, all weighted 1 if empty. Tops limits the number of the
+	// merged or voted answers if it's positive.
+	ComboConfig struct {
+		Strategy      ComboStrategy
+		MinConfidence float32
+		Weights       []float32
+		Tops          int
+	}
+
+	comboMatch struct {
+		matches []LogicAdapter
+		ComboConfig
+	}
+)
 
 func NewComboMatch(matches ...LogicAdapter) LogicAdapter {
 	return &comboMatch{
@@ -10,6 +50,58 @@ func NewComboMatch(matches ...LogicAdapter) LogicAdapter {
 	}
 }
 
+// NewFallbackMatch tries the matches in order, and falls back to the next one
+// if a match gives no answer with confidence of at least minConfidence.
+func NewFallbackMatch(minConfidence float32, matches ...LogicAdapter) LogicAdapter {
+	return &comboMatch{
+		matches: matches,
+		ComboConfig: ComboConfig{
+			Strategy:      FirstAboveThreshold,
+			MinConfidence: minConfidence,
+		},
+	}
+}
+
+// NewStrategyComboMatch combines the matches with the strategy of conf.
+func NewStrategyComboMatch(conf ComboConfig, matches ...LogicAdapter) (LogicAdapter, error) {
+	if len(conf.Weights) == 0 {
+		conf.Weights = make([]float32, len(matches))
+		for i := range conf.Weights {
+			conf.Weights[i] = 1
+		}
+	} else if len(conf.Weights) != len(matches) {
+		return nil, fmt.Errorf("%d weights for %d matches", len(conf.Weights), len(matches))
+	}
+
+	for _, weight := range conf.Weights {
+		if weight < 0 {
+			return nil, errors.New("weights must not be negative")
+		}
+	}
+
+	return &comboMatch{
+		matches:     matches,
+		ComboConfig: conf,
+	}, nil
+}
+
+// ParseComboStrategy parses the name of a combo strategy, fallback, first,
+// merge or vote.
+func ParseComboStrategy(name string) (ComboStrategy, error) {
+	switch name {
+	case "", "fallback":
+		return FirstAboveThreshold, nil
+	case "first":
+		return FirstMatch, nil
+	case "merge":
+		return MergeByConfidence, nil
+	case "vote":
+		return WeightedVote, nil
+	default:
+		return FirstAboveThreshold, fmt.Errorf("unknown combo strategy: %s", name)
+	}
+}
+
 func (match *comboMatch) CanProcess(question string) bool {
 	for _, each := range match.matches {
 		if each.CanProcess(question) {
@@ -20,12 +112,59 @@ func (match *comboMatch) CanProcess(question string) bool {
 }
 
 func (match *comboMatch) Process(question string) []Answer {
-	for _, each := range match.matches {
-		if each.CanProcess(question) {
-			return each.Process(question)
+	return match.ProcessWithHistory(question, nil)
+}
+
+// ProcessWithHistory passes the history to the matches which support it.
+func (match *comboMatch) ProcessWithHistory(question string, history []string) []Answer {
+	return match.ProcessWithTrace(question, history, nil)
+}
+
+// ProcessWithTrace is ProcessWithHistory that traces the matches, and explains
+// how their answers are combined into trace, if not nil.
+func (match *comboMatch) ProcessWithTrace(question string, history []string, trace *Trace) []Answer {
+	switch match.Strategy {
+	case FirstMatch:
+		for _, each := range match.matches {
+			if each.CanProcess(question) {
+				answers := ProcessWithTrace(each, question, history, trace)
+				trace.addStep("combo", answers, fmt.Sprintf("the first adapter to process, %s", adapterName(each)))
+				return answers
+			}
 		}
+		return nil
+	case MergeByConfidence:
+		answers := match.merge(question, history, trace)
+		trace.addStep("combo", answers, "the answers of the adapters merged by confidence")
+		return answers
+	case WeightedVote:
+		answers := match.vote(question, history, trace)
+		trace.addStep("combo", answers, fmt.Sprintf("the answers voted by the adapters weighted %v", match.Weights))
+		return answers
+	default:
+		return match.fallback(question, history, trace)
+	}
+}
+
+// SetFeedback gives the feedback to the matches which learn from it.
+func (match *comboMatch) SetFeedback(feedback *FeedbackSet) {
+	for _, each := range match.matches {
+		SetFeedback(each, feedback)
+	}
+}
+
+// SetTerms gives the terms to the matches which rank by them.
+func (match *comboMatch) SetTerms(terms *nlp.Terms) {
+	for _, each := range match.matches {
+		SetTerms(each, terms)
+	}
+}
+
+// Refresh refreshes the matches which index the stored questions.
+func (match *comboMatch) Refresh() {
+	for _, each := range match.matches {
+		Refresh(each)
 	}
-	return nil
 }
 
 func (match *comboMatch) SetVerbose() {
@@ -33,3 +172,107 @@ func (match *comboMatch) SetVerbose() {
 		each.SetVerbose()
 	}
 }
+
+func (match *comboMatch) fallback(question string, history []string, trace *Trace) []Answer {
+	for _, each := range match.matches {
+		if !each.CanProcess(question) {
+			continue
+		}
+
+		answers := ProcessWithTrace(each, question, history, trace)
+		for _, answer := range answers {
+			if answer.Confidence >= match.MinConfidence {
+				trace.addStep("combo", answers, fmt.Sprintf("%s answered with a confidence of at least %.3f",
+					adapterName(each), match.MinConfidence))
+				return answers
+			}
+		}
+		trace.note(adapterName(each), "no answer with a confidence of at least %.3f, falling back",
+			match.MinConfidence)
+	}
+	return nil
+}
+
+func (match *comboMatch) merge(question string, history []string, trace *Trace) []Answer {
+	var answers []Answer
+	positions := make(map[string]int)
+	for _, each := range match.matches {
+		if !each.CanProcess(question) {
+			continue
+		}
+
+		for _, answer := range ProcessWithTrace(each, question, history, trace) {
+			if i, ok := positions[answer.Content]; ok {
+				if answer.Confidence > answers[i].Confidence {
+					answers[i] = answer
+				}
+				continue
+			}
+
+			positions[answer.Content] = len(answers)
+			answers = append(answers, answer)
+		}
+	}
+
+	return match.rerank(answers)
+}
+
+func (match *comboMatch) vote(question string, history []string, trace *Trace) []Answer {
+	var answers []Answer
+	// voters[j] is the last match that voted for answers[j]
+	var voters []int
+	var totalWeight float32
+	positions := make(map[string]int)
+	for i, each := range match.matches {
+		if !each.CanProcess(question) {
+			continue
+		}
+
+		// the matches without any answers abstain from voting
+		processed := ProcessWithTrace(each, question, history, trace)
+		weight := match.Weights[i]
+		if len(processed) > 0 {
+			totalWeight += weight
+		}
+		for _, answer := range processed {
+			j, ok := positions[answer.Content]
+			if !ok {
+				j = len(answers)
+				positions[answer.Content] = j
+				vote := answer
+				vote.Confidence = 0
+				vote.Scores = make(map[string]float32)
+				answers = append(answers, vote)
+				voters = append(voters, i)
+			} else if voters[j] == i {
+				// only the best confidence of a match counts
+				continue
+			} else {
+				voters[j] = i
+				answers[j].Adapter += "+" + answer.Adapter
+			}
+
+			answers[j].Confidence += weight * answer.Confidence
+			answers[j].Scores[answer.Adapter] = answer.Confidence
+		}
+	}
+
+	if totalWeight > 0 {
+		for i := range answers {
+			answers[i].Confidence /= totalWeight
+		}
+	}
+
+	return match.rerank(answers)
+}
+
+func (match *comboMatch) rerank(answers []Answer) []Answer {
+	sort.SliceStable(answers, func(i, j int) bool {
+		return answers[i].Confidence > answers[j].Confidence
+	})
+	if match.Tops > 0 && len(answers) > match.Tops {
+		answers = answers[:match.Tops]
+	}
+
+	return answers
+}
@@ -0,0 +1,126 @@
+package logic
+
+import "testing"
+
+type stubMatch []Answer
+
+func (match stubMatch) CanProcess(string) bool {
+	return len(match) > 0
+}
+
+func (match stubMatch) Process(string) []Answer {
+	return match
+}
+
+func (match stubMatch) SetVerbose() {
+}
+
+func TestComboMatchStrategies(t *testing.T) {
+	closest := stubMatch{
+		{Content: "a", Confidence: 0.4, Adapter: "closest"},
+		{Content: "b", Confidence: 0.3, Adapter: "closest"},
+	}
+	semantic := stubMatch{
+		{Content: "b", Confidence: 0.9, Adapter: "semantic"},
+		{Content: "c", Confidence: 0.2, Adapter: "semantic"},
+	}
+
+	tests := []struct {
+		strategy ComboStrategy
+		weights  []float32
+		expect   []Answer
+	}{
+		{
+			strategy: FirstMatch,
+			expect:   closest,
+		},
+		{
+			strategy: FirstAboveThreshold,
+			expect:   semantic,
+		},
+		{
+			strategy: MergeByConfidence,
+			expect: []Answer{
+				{Content: "b", Confidence: 0.9, Adapter: "semantic"},
+				{Content: "a", Confidence: 0.4, Adapter: "closest"},
+				{Content: "c", Confidence: 0.2, Adapter: "semantic"},
+			},
+		},
+		{
+			strategy: WeightedVote,
+			weights:  []float32{3, 1},
+			expect: []Answer{
+				{Content: "b", Confidence: 0.45, Adapter: "closest+semantic"},
+				{Content: "a", Confidence: 0.3, Adapter: "closest"},
+				{Content: "c", Confidence: 0.05, Adapter: "semantic"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		match, err := NewStrategyComboMatch(ComboConfig{
+			Strategy:      test.strategy,
+			MinConfidence: 0.5,
+			Weights:       test.weights,
+		}, closest, semantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		answers := match.Process("q")
+		if len(answers) != len(test.expect) {
+			t.Fatalf("strategy %d: expect %v, got %v", test.strategy, test.expect, answers)
+		}
+		for i, answer := range answers {
+			expect := test.expect[i]
+			if answer.Content != expect.Content || answer.Adapter != expect.Adapter ||
+				answer.Confidence-expect.Confidence > 1e-6 || expect.Confidence-answer.Confidence > 1e-6 {
+				t.Errorf("strategy %d: expect %v, got %v", test.strategy, expect, answer)
+			}
+		}
+	}
+}
+
+func TestFallbackMatch(t *testing.T) {
+	store := stubStorage{
+		"how to restart the service": {{Answer: "restart", CorpusId: 1, Occurrence: 1}},
+	}
+	match := NewFallbackMatch(0.6, NewExactMatch(store, 1), NewClosestMatch(store, 1),
+		NewDefaultMatch("sorry"))
+
+	tests := []struct {
+		question string
+		adapter  string
+		content  string
+	}{
+		{
+			question: "how to restart the service",
+			adapter:  "exact",
+			content:  "restart",
+		},
+		{
+			question: "how to restart the services",
+			adapter:  "closest",
+			content:  "restart",
+		},
+		{
+			// the closest answer is below the threshold
+			question: "where are the logs",
+			adapter:  "default",
+			content:  "sorry",
+		},
+	}
+
+	for _, test := range tests {
+		answers := match.Process(test.question)
+		if len(answers) == 0 || answers[0].Adapter != test.adapter || answers[0].Content != test.content {
+			t.Errorf("%s: expect %s by %s, got %v", test.question, test.content, test.adapter, answers)
+		}
+	}
+
+	// without a default, nothing above the threshold is no answer
+	match = NewFallbackMatch(0.6, NewExactMatch(store, 1), NewClosestMatch(store, 1))
+	if answers := match.Process("where are the logs"); len(answers) != 0 {
+		t.Fatalf("expected no answer, got %v", answers)
+	}
+}
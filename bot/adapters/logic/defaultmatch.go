@@ -0,0 +1,30 @@
+package logic
+
+// defaultMatch always answers with the same reply, as the last resort of a
+// fallback match.
+type defaultMatch struct {
+	reply string
+}
+
+func NewDefaultMatch(reply string) LogicAdapter {
+	return &defaultMatch{
+		reply: reply,
+	}
+}
+
+func (match *defaultMatch) CanProcess(string) bool {
+	return len(match.reply) > 0
+}
+
+func (match *defaultMatch) Process(string) []Answer {
+	return []Answer{
+		{
+			Content:    match.reply,
+			Confidence: 1,
+			Adapter:    "default",
+		},
+	}
+}
+
+func (match *defaultMatch) SetVerbose() {
+}
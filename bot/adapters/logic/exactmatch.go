@@ -0,0 +1,49 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+)
+
+// exactMatch answers with the responses of the stored question that equals
+// the question, with full confidence.
+type exactMatch struct {
+	verbose bool
+	storage storage.StorageAdapter
+	tops    int
+}
+
+func NewExactMatch(storage storage.StorageAdapter, tops int) LogicAdapter {
+	return &exactMatch{
+		storage: storage,
+		tops:    tops,
+	}
+}
+
+func (match *exactMatch) CanProcess(string) bool {
+	return true
+}
+
+func (match *exactMatch) Process(text string) []Answer {
+	responses, ok := match.storage.Find(text)
+	if !ok {
+		return nil
+	}
+
+	responses = topResponses(responses, match.tops)
+	if match.verbose {
+		fmt.Println("exactly matched:", len(responses))
+	}
+
+	answers := make([]Answer, 0, len(responses))
+	for _, response := range responses {
+		answers = append(answers, newAnswer(text, response, 1, "exact"))
+	}
+
+	return answers
+}
+
+func (match *exactMatch) SetVerbose() {
+	match.verbose = true
+}
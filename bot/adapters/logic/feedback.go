@@ -0,0 +1,152 @@
+package logic
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultFeedbackWeight is how much the feedback of a corpus moves the
+	// confidences of its answers, up to the weight either way.
+	DefaultFeedbackWeight = 0.2
+	// feedbackSmoothing is the pseudo feedback, half accepted and half
+	// rejected, that the feedback of each corpus is smoothed with, so that a
+	// few votes don't move the answers much.
+	feedbackSmoothing = 10
+	// feedbackCandidates is how many times tops candidates to rerank by the
+	// feedback, so that the well received answers can move up into the tops.
+	feedbackCandidates = 2
+)
+
+type (
+	// FeedbackCounts is the times the answers of a corpus are accepted and
+	// rejected by the users.
+	FeedbackCounts struct {
+		Accepts int
+		Rejects int
+	}
+
+	// FeedbackSet holds what the users think of the answers, which can be
+	// replaced while matching. The answers are reranked by the acceptance
+	// rates of their corpora, and the questions confirmed by the users are
+	// answered as the stored questions they are confirmed to be.
+	FeedbackSet struct {
+		lock   sync.RWMutex
+		weight float32
+		counts map[int]FeedbackCounts
+		// the normalized questions of the users, and the stored questions
+		associations map[string]string
+	}
+
+	// FeedbackAdapter is a LogicAdapter which learns from the feedback.
+	FeedbackAdapter interface {
+		LogicAdapter
+		SetFeedback(feedback *FeedbackSet)
+	}
+)
+
+// NewFeedbackSet returns an empty feedback set, weight is how much the
+// feedback moves the confidences, 0 for none.
+func NewFeedbackSet(weight float32) *FeedbackSet {
+	return &FeedbackSet{
+		weight: weight,
+	}
+}
+
+// SetFeedback gives the feedback to the match if it's a FeedbackAdapter.
+func SetFeedback(match LogicAdapter, feedback *FeedbackSet) {
+	if adapter, ok := match.(FeedbackAdapter); ok {
+		adapter.SetFeedback(feedback)
+	}
+}
+
+// Set replaces the feedback counts of the corpora by their ids, and the
+// questions confirmed by the users with the stored questions.
+func (set *FeedbackSet) Set(counts map[int]FeedbackCounts, associations map[string]string) {
+	normalized := make(map[string]string, len(associations))
+	for question, stored := range associations {
+		normalized[normalizeQuestion(question)] = stored
+	}
+
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	set.counts = counts
+	set.associations = normalized
+}
+
+// Associated returns the stored question that the users confirmed the
+// question to be.
+func (set *FeedbackSet) Associated(question string) (string, bool) {
+	if set == nil {
+		return "", false
+	}
+
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	stored, ok := set.associations[normalizeQuestion(question)]
+	return stored, ok
+}
+
+// Prior returns the acceptance rate of the answers of the corpus, smoothed
+// towards 0.5, which is the rate of the corpora without feedback.
+func (set *FeedbackSet) Prior(id int) float32 {
+	if set == nil {
+		return 0.5
+	}
+
+	set.lock.RLock()
+	counts := set.counts[id]
+	set.lock.RUnlock()
+
+	return (float32(counts.Accepts) + feedbackSmoothing/2) /
+		float32(counts.Accepts+counts.Rejects+feedbackSmoothing)
+}
+
+// enabled tells whether there is any feedback to rerank by.
+func (set *FeedbackSet) enabled() bool {
+	if set == nil || set.weight <= 0 {
+		return false
+	}
+
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	return len(set.counts) > 0
+}
+
+// rerank scales the confidences of the answers by the priors of their
+// corpora, between 1-weight and 1+weight, and reorders them. The priors are
+// kept in the scores of the answers as feedback.
+func (set *FeedbackSet) rerank(answers []Answer) []Answer {
+	if !set.enabled() {
+		return answers
+	}
+
+	for i := range answers {
+		if answers[i].CorpusId <= 0 {
+			continue
+		}
+
+		prior := set.Prior(answers[i].CorpusId)
+		confidence := answers[i].Confidence * (1 + set.weight*(2*prior-1))
+		if confidence > 1 {
+			confidence = 1
+		}
+		answers[i].Confidence = confidence
+		if answers[i].Scores == nil {
+			answers[i].Scores = make(map[string]float32)
+		}
+		answers[i].Scores["feedback"] = prior
+	}
+	sort.SliceStable(answers, func(i, j int) bool {
+		return answers[i].Confidence > answers[j].Confidence
+	})
+
+	return answers
+}
+
+// normalizeQuestion drops the case, the spaces around and the question marks
+// at the end of the question.
+func normalizeQuestion(question string) string {
+	return strings.TrimRight(strings.ToLower(strings.TrimSpace(question)), "?？ ")
+}
@@ -0,0 +1,101 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+)
+
+// stubStorage finds all its questions by any search.
+type stubStorage map[string][]storage.Response
+
+func (store stubStorage) BuildIndex() {}
+
+func (store stubStorage) Compact() {}
+
+func (store stubStorage) Count() int {
+	return len(store)
+}
+
+func (store stubStorage) Find(question string) ([]storage.Response, bool) {
+	responses, ok := store[question]
+	return responses, ok
+}
+
+func (store stubStorage) Keys() []string {
+	keys := make([]string, 0, len(store))
+	for key := range store {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (store stubStorage) Search(string) []string {
+	return store.Keys()
+}
+
+func (store stubStorage) Remove(question string) {
+	delete(store, question)
+}
+
+func (store stubStorage) Sync() error {
+	return nil
+}
+
+func (store stubStorage) Update(question string, responses []storage.Response) {
+	store[question] = responses
+}
+
+func TestClosestMatchFeedback(t *testing.T) {
+	store := stubStorage{
+		"how to restart the service": {{Answer: "restart", CorpusId: 1, Occurrence: 1}},
+		"how to restart the server":  {{Answer: "reboot", CorpusId: 2, Occurrence: 1}},
+	}
+	match := NewClosestMatch(store, 1)
+	if answers := match.Process("how to restart the servic"); len(answers) != 1 || answers[0].CorpusId != 1 {
+		t.Fatalf("expected the most similar answer without feedback, got %v", answers)
+	}
+
+	feedback := NewFeedbackSet(DefaultFeedbackWeight)
+	SetFeedback(match, feedback)
+	feedback.Set(map[int]FeedbackCounts{
+		1: {Accepts: 1, Rejects: 20},
+		2: {Accepts: 30, Rejects: 2},
+	}, map[string]string{
+		"how do I bounce it?": "how to restart the server",
+	})
+
+	answers := match.Process("how to restart the servic")
+	if len(answers) != 1 || answers[0].CorpusId != 2 {
+		t.Fatalf("expected the well received answer reranked to the top, got %v", answers)
+	}
+	if prior := answers[0].Scores["feedback"]; prior != feedback.Prior(2) || prior <= 0.5 {
+		t.Fatalf("expected the prior in the scores, got %v", answers[0].Scores)
+	}
+
+	answers = match.Process("How do I bounce it")
+	if len(answers) != 1 || answers[0].CorpusId != 2 || answers[0].Confidence != 1 {
+		t.Fatalf("expected the confirmed question answered directly, got %v", answers)
+	}
+}
+
+func TestFeedbackPrior(t *testing.T) {
+	feedback := NewFeedbackSet(DefaultFeedbackWeight)
+	feedback.Set(map[int]FeedbackCounts{
+		1: {Accepts: 1},
+		2: {Accepts: 100},
+	}, nil)
+
+	if prior := feedback.Prior(3); prior != 0.5 {
+		t.Fatalf("expected the neutral prior without feedback, got %v", prior)
+	}
+	if prior := feedback.Prior(1); prior <= 0.5 || prior > 0.6 {
+		t.Fatalf("expected a single accept smoothed, got %v", prior)
+	}
+	if prior := feedback.Prior(2); prior < 0.9 {
+		t.Fatalf("expected many accepts to count, got %v", prior)
+	}
+	if prior := (*FeedbackSet)(nil).Prior(1); prior != 0.5 {
+		t.Fatalf("expected the neutral prior of nil feedback, got %v", prior)
+	}
+}
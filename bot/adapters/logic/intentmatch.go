@@ -0,0 +1,314 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kevwan/chatbot/bot/nlp"
+	"github.com/kevwan/chatbot/bot/rich"
+)
+
+// intentThreshold is the minimum similarity of a question to an intent
+const intentThreshold = 0.6
+
+type (
+	// Slot is a parameter of an intent, its value is extracted by Pattern, the
+	// first group if any, otherwise by the enumeration of Values. Prompt asks
+	// for the value of a required slot if it's missing.
+	Slot struct {
+		Name     string   `json:"name"`
+		Pattern  string   `json:"pattern"`
+		Values   []string `json:"values"`
+		Required bool     `json:"required"`
+		Prompt   string   `json:"prompt"`
+		Default  string   `json:"default"`
+	}
+
+	// Intent is a parameterised question. Questions may refer to the slots as
+	// {name}, and Answer is a template with the slot values as .Slots.
+	Intent struct {
+		Id        int
+		Class     string
+		Project   string
+		Questions []string
+		Slots     []Slot
+		Answer    string
+		Blocks    []rich.Block
+	}
+
+	// Pending is the intent waiting for the value of its required Slot, with
+	// the Values of the slots given so far. It's kept in the session, so that
+	// the next question continues the intent.
+	Pending struct {
+		Intent int
+		Slot   string
+		Values map[string]string
+	}
+
+	// IntentSet holds the intents of the intent matches, which can be replaced
+	// while matching.
+	IntentSet struct {
+		lock    sync.RWMutex
+		intents []*compiledIntent
+	}
+
+	compiledIntent struct {
+		Intent
+		// patterns of the slots, nil for the enumerated slots
+		patterns []*regexp.Regexp
+		// values of the enumerated slots, the longest first
+		values [][]string
+	}
+
+	intentMatch struct {
+		verbose bool
+		intents *IntentSet
+	}
+)
+
+func NewIntentSet() *IntentSet {
+	return &IntentSet{}
+}
+
+// Set replaces the intents, the invalid ones are skipped and reported by the
+// returned error.
+func (set *IntentSet) Set(intents []Intent) error {
+	var errs []string
+	compiled := make([]*compiledIntent, 0, len(intents))
+	for _, intent := range intents {
+		each, err := compileIntent(intent)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("intent %d: %v", intent.Id, err))
+			continue
+		}
+		compiled = append(compiled, each)
+	}
+
+	set.lock.Lock()
+	set.intents = compiled
+	set.lock.Unlock()
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (set *IntentSet) list() []*compiledIntent {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+
+	return set.intents
+}
+
+// NewIntentMatch answers with the intents in the set. The values of the slots
+// are extracted from the question, and the missing required slots are asked
+// for one by one, the answers to the prompts continue the intents by
+// IntentSet.Continue.
+func NewIntentMatch(intents *IntentSet) LogicAdapter {
+	return &intentMatch{
+		intents: intents,
+	}
+}
+
+func (match *intentMatch) CanProcess(string) bool {
+	return len(match.intents.list()) > 0
+}
+
+func (match *intentMatch) Process(text string) []Answer {
+	var best *compiledIntent
+	var bestQuestion string
+	var bestScore float32
+	var bestValues map[string]string
+	for _, intent := range match.intents.list() {
+		values, normalized := intent.extract(text)
+		for _, question := range intent.Questions {
+			score := nlp.SimilarityForStrings(normalized, strings.ToLower(question))
+			if score > bestScore {
+				best = intent
+				bestQuestion = question
+				bestScore = score
+				bestValues = values
+			}
+		}
+	}
+
+	if match.verbose && best != nil {
+		fmt.Printf("intent matched: %d\t%.3f\t%v\n", best.Id, bestScore, bestValues)
+	}
+	if best == nil || bestScore < intentThreshold {
+		return nil
+	}
+
+	return []Answer{best.respond(bestQuestion, bestValues, bestScore)}
+}
+
+func (match *intentMatch) SetVerbose() {
+	match.verbose = true
+}
+
+// Continue continues the pending intent with the slot values in the text, and
+// explains it into trace if not nil. It returns no answers if there is no
+// pending intent, the intent is gone, or the text gives no more values, then
+// the text is to be answered out of the context.
+func (set *IntentSet) Continue(pending *Pending, text string, trace *Trace) []Answer {
+	if set == nil || pending == nil {
+		return nil
+	}
+
+	var intent *compiledIntent
+	for _, each := range set.list() {
+		if each.Id == pending.Intent {
+			intent = each
+			break
+		}
+	}
+	if intent == nil {
+		return nil
+	}
+
+	values := make(map[string]string, len(pending.Values))
+	for name, value := range pending.Values {
+		values[name] = value
+	}
+	extracted, _ := intent.extract(text)
+	var filled bool
+	for name, value := range extracted {
+		if _, ok := values[name]; !ok {
+			filled = true
+		}
+		values[name] = value
+	}
+	if !filled {
+		return nil
+	}
+
+	answers := []Answer{intent.respond(intent.Questions[0], values, 1)}
+	trace.addStep("intent", answers, fmt.Sprintf("continues intent %d waiting for slot %s",
+		intent.Id, pending.Slot))
+	return answers
+}
+
+func compileIntent(intent Intent) (*compiledIntent, error) {
+	if len(intent.Questions) == 0 {
+		return nil, fmt.Errorf("no questions")
+	}
+
+	patterns := make([]*regexp.Regexp, len(intent.Slots))
+	values := make([][]string, len(intent.Slots))
+	for i, slot := range intent.Slots {
+		if slot.Required && len(slot.Prompt) == 0 {
+			return nil, fmt.Errorf("required slot %s without prompt", slot.Name)
+		}
+
+		if len(slot.Pattern) > 0 {
+			pattern, err := regexp.Compile("(?i)" + slot.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			patterns[i] = pattern
+		} else if len(slot.Values) == 0 {
+			return nil, fmt.Errorf("slot %s without pattern or values", slot.Name)
+		} else {
+			values[i] = append([]string(nil), slot.Values...)
+			sort.SliceStable(values[i], func(j, k int) bool {
+				return len(values[i][j]) > len(values[i][k])
+			})
+		}
+	}
+
+	if _, err := parseTemplate(intent.Answer); err != nil {
+		return nil, err
+	}
+
+	return &compiledIntent{
+		Intent:   intent,
+		patterns: patterns,
+		values:   values,
+	}, nil
+}
+
+// extract returns the values of the slots in the text, and the lower cased
+// text with the values replaced by the {name} of their slots.
+func (intent *compiledIntent) extract(text string) (map[string]string, string) {
+	values := make(map[string]string)
+	normalized := strings.ToLower(text)
+	for i, slot := range intent.Slots {
+		var value string
+		if pattern := intent.patterns[i]; pattern != nil {
+			matches := pattern.FindStringSubmatch(text)
+			if len(matches) > 1 {
+				value = matches[1]
+			} else if len(matches) == 1 {
+				value = matches[0]
+			}
+		} else {
+			value = enumerate(intent.values[i], normalized)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) == 0 {
+			continue
+		}
+
+		values[slot.Name] = value
+		normalized = strings.Replace(normalized, strings.ToLower(value), "{"+strings.ToLower(slot.Name)+"}", 1)
+	}
+
+	return values, normalized
+}
+
+// respond asks for the first missing required slot, with the intent pending
+// for it, or answers with the slot values to render the answer.
+func (intent *compiledIntent) respond(question string, values map[string]string, confidence float32) Answer {
+	answer := Answer{
+		Confidence: confidence,
+		Adapter:    "intent",
+		Question:   question,
+		CorpusId:   intent.Id,
+		Class:      intent.Class,
+		Project:    intent.Project,
+		Scores: map[string]float32{
+			"similarity": confidence,
+		},
+	}
+
+	slots := make(map[string]string, len(intent.Slots))
+	for _, slot := range intent.Slots {
+		value, ok := values[slot.Name]
+		if !ok {
+			value = slot.Default
+		}
+		if len(value) == 0 && slot.Required {
+			answer.Content = slot.Prompt
+			answer.Pending = &Pending{
+				Intent: intent.Id,
+				Slot:   slot.Name,
+				Values: values,
+			}
+			return answer
+		}
+
+		slots[slot.Name] = value
+	}
+
+	answer.Content = intent.Answer
+	answer.Slots = slots
+	answer.Blocks = intent.Blocks
+	return answer
+}
+
+// enumerate returns the first of the values in the lower cased text.
+func enumerate(values []string, text string) string {
+	for _, value := range values {
+		if len(value) > 0 && strings.Contains(text, strings.ToLower(value)) {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,151 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestIntents(t *testing.T) *IntentSet {
+	set := NewIntentSet()
+	err := set.Set([]Intent{
+		{
+			Id:        1,
+			Questions: []string{"book a flight from {from} to {to}", "book a flight"},
+			Slots: []Slot{
+				{Name: "from", Values: []string{"beijing", "shanghai"}, Required: true, Prompt: "which city?"},
+				{Name: "to", Pattern: `to (\w+)`, Required: true, Prompt: "where to?"},
+				{Name: "class", Values: []string{"economy", "business"}, Default: "economy"},
+			},
+			Answer: "flight {{.Slots.from}}-{{.Slots.to}} {{.Slots.class}}",
+		},
+		{
+			Id:        2,
+			Questions: []string{"weather in {city}", "weather"},
+			Slots: []Slot{
+				// the same prompt as the flight's
+				{Name: "city", Values: []string{"beijing", "shanghai"}, Required: true, Prompt: "which city?"},
+			},
+			Answer: "weather of {{.Slots.city}}",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return set
+}
+
+func TestIntentMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		turns   []string
+		remove  bool
+		content string
+		slots   map[string]string
+		pending *Pending
+	}{
+		{
+			name:    "complete fill",
+			turns:   []string{"book a flight from beijing to guangzhou business"},
+			content: "flight {{.Slots.from}}-{{.Slots.to}} {{.Slots.class}}",
+			slots:   map[string]string{"from": "beijing", "to": "guangzhou", "class": "business"},
+		},
+		{
+			name:    "the first missing slot asked",
+			turns:   []string{"book a flight"},
+			content: "which city?",
+			pending: &Pending{Intent: 1, Slot: "from", Values: map[string]string{}},
+		},
+		{
+			name:    "multi-turn fill",
+			turns:   []string{"book a flight", "from shanghai", "to guangzhou"},
+			content: "flight {{.Slots.from}}-{{.Slots.to}} {{.Slots.class}}",
+			slots:   map[string]string{"from": "shanghai", "to": "guangzhou", "class": "economy"},
+		},
+		{
+			name:    "the next missing slot asked",
+			turns:   []string{"book a flight", "shanghai"},
+			content: "where to?",
+			pending: &Pending{Intent: 1, Slot: "to", Values: map[string]string{"from": "shanghai"}},
+		},
+		{
+			// the flight and the weather ask the same prompt
+			name:    "shared prompt",
+			turns:   []string{"weather", "beijing"},
+			content: "weather of {{.Slots.city}}",
+			slots:   map[string]string{"city": "beijing"},
+		},
+		{
+			name:    "shared prompt of the other intent",
+			turns:   []string{"book a flight", "beijing"},
+			content: "where to?",
+			pending: &Pending{Intent: 1, Slot: "to", Values: map[string]string{"from": "beijing"}},
+		},
+		{
+			name:  "abandoned intent",
+			turns: []string{"book a flight", "something else", "beijing"},
+		},
+		{
+			name:   "cancelled intent",
+			turns:  []string{"book a flight", "beijing"},
+			remove: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := newTestIntents(t)
+			match := NewIntentMatch(set)
+
+			var pending *Pending
+			var answers []Answer
+			for i, text := range test.turns {
+				if test.remove && i == len(test.turns)-1 {
+					set.Set(nil)
+				}
+				// the pending intent is continued first, like a session does
+				answers = set.Continue(pending, text, nil)
+				if len(answers) == 0 && match.CanProcess(text) {
+					answers = match.Process(text)
+				}
+				pending = nil
+				if len(answers) > 0 {
+					pending = answers[0].Pending
+				}
+			}
+
+			if len(test.content) == 0 {
+				if len(answers) > 0 {
+					t.Fatalf("expected no answer, got %v", answers)
+				}
+				return
+			}
+			if len(answers) != 1 || answers[0].Content != test.content {
+				t.Fatalf("expected %s, got %v", test.content, answers)
+			}
+			if !reflect.DeepEqual(answers[0].Slots, test.slots) {
+				t.Fatalf("expected slots %v, got %v", test.slots, answers[0].Slots)
+			}
+			if !reflect.DeepEqual(pending, test.pending) {
+				t.Fatalf("expected pending %v, got %v", test.pending, pending)
+			}
+		})
+	}
+}
+
+func TestIntentSetInvalid(t *testing.T) {
+	set := NewIntentSet()
+	err := set.Set([]Intent{
+		{Id: 1},
+		{Id: 2, Questions: []string{"q"}, Slots: []Slot{{Name: "s", Values: []string{"v"}, Required: true}}},
+		{Id: 3, Questions: []string{"q"}, Slots: []Slot{{Name: "s"}}},
+		{Id: 4, Questions: []string{"q"}, Slots: []Slot{{Name: "s", Pattern: "("}}},
+		{Id: 5, Questions: []string{"q"}, Answer: "ok"},
+	})
+	if err == nil {
+		t.Fatal("expected the invalid intents reported")
+	}
+	if intents := set.list(); len(intents) != 1 || intents[0].Id != 5 {
+		t.Fatalf("expected only the valid intent kept, got %d", len(intents))
+	}
+}
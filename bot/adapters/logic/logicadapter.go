@@ -1,10 +1,29 @@
 package logic
 
+import (
+	"sort"
+
+	"github.com/kevwan/chatbot/bot/rich"
+
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+)
+
 type (
 	Answer struct {
 		//Title      string  `json:"title"`
-		Content    string  `json:"content"`
-		Confidence float32 `json:"confidence"`
+		Content    string             `json:"content"`
+		Confidence float32            `json:"confidence"`
+		Adapter    string             `json:"adapter"`
+		Question   string             `json:"question"`
+		CorpusId   int                `json:"corpus_id"`
+		Class      string             `json:"class"`
+		Project    string             `json:"project"`
+		Scores     map[string]float32 `json:"scores,omitempty"`
+		Groups     []string           `json:"groups,omitempty"`
+		Slots      map[string]string  `json:"slots,omitempty"`
+		Blocks     []rich.Block       `json:"blocks,omitempty"`
+		// the intent waiting for a slot value, if the answer asks for it
+		Pending *Pending `json:"-"`
 	}
 
 	LogicAdapter interface {
@@ -12,4 +31,50 @@ type (
 		Process(string) []Answer
 		SetVerbose()
 	}
+
+	// HistoryAdapter is a LogicAdapter which answers in the context of the
+	// conversation, history is the previous sentences, the earliest first.
+	HistoryAdapter interface {
+		LogicAdapter
+		ProcessWithHistory(text string, history []string) []Answer
+	}
 )
+
+// ProcessWithHistory processes the text with the history if the match is a
+// HistoryAdapter, otherwise without.
+func ProcessWithHistory(match LogicAdapter, text string, history []string) []Answer {
+	if adapter, ok := match.(HistoryAdapter); ok && len(history) > 0 {
+		return adapter.ProcessWithHistory(text, history)
+	}
+
+	return match.Process(text)
+}
+
+// newAnswer returns the answer of the response to the matched question.
+func newAnswer(question string, response storage.Response, confidence float32, adapter string) Answer {
+	return Answer{
+		Content:    response.Answer,
+		Confidence: confidence,
+		Adapter:    adapter,
+		Question:   question,
+		CorpusId:   response.CorpusId,
+		Class:      response.Class,
+		Project:    response.Project,
+		Blocks:     response.Blocks,
+	}
+}
+
+// topResponses returns up to tops responses with the most occurrences.
+func topResponses(responses []storage.Response, tops int) []storage.Response {
+	sort.SliceStable(responses, func(i, j int) bool {
+		if responses[i].Occurrence != responses[j].Occurrence {
+			return responses[i].Occurrence > responses[j].Occurrence
+		}
+		return responses[i].Answer < responses[j].Answer
+	})
+	if len(responses) > tops {
+		responses = responses[:tops]
+	}
+
+	return responses
+}
@@ -0,0 +1,71 @@
+package logic
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type (
+	// Rule answers the questions matching the regular expression Pattern,
+	// case insensitively, with Response, which may refer to the captured
+	// groups as .Groups in the template.
+	Rule struct {
+		Pattern  string `json:"pattern"`
+		Response string `json:"response"`
+	}
+
+	rulesMatch struct {
+		verbose  bool
+		patterns []*regexp.Regexp
+		rules    []Rule
+	}
+)
+
+// NewRulesMatch answers with the responses of all the matched rules, in the
+// order of the rules.
+func NewRulesMatch(rules []Rule) (LogicAdapter, error) {
+	patterns := make([]*regexp.Regexp, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return &rulesMatch{
+		patterns: patterns,
+		rules:    rules,
+	}, nil
+}
+
+func (match *rulesMatch) CanProcess(string) bool {
+	return len(match.rules) > 0
+}
+
+func (match *rulesMatch) Process(text string) []Answer {
+	var answers []Answer
+	for i, pattern := range match.patterns {
+		groups := pattern.FindStringSubmatch(text)
+		if groups == nil {
+			continue
+		}
+
+		if match.verbose {
+			fmt.Println("matched rule:", match.rules[i].Pattern)
+		}
+		answers = append(answers, Answer{
+			Content:    match.rules[i].Response,
+			Confidence: 1,
+			Adapter:    "rules",
+			Question:   match.rules[i].Pattern,
+			Groups:     groups,
+		})
+	}
+
+	return answers
+}
+
+func (match *rulesMatch) SetVerbose() {
+	match.verbose = true
+}
@@ -0,0 +1,178 @@
+package logic
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+	"github.com/kevwan/chatbot/bot/nlp"
+)
+
+const staleCheckInterval = 10 * time.Second
+
+// RefreshAdapter is a LogicAdapter which keeps an index of the stored
+// questions, and rebuilds it by Refresh if the questions changed.
+type RefreshAdapter interface {
+	LogicAdapter
+	Refresh()
+}
+
+// semanticMatch answers with the responses of the stored questions whose
+// embeddings are the closest to the question's.
+type semanticMatch struct {
+	verbose   bool
+	storage   storage.StorageAdapter
+	embedder  nlp.Embedder
+	indexFile string
+	tops      int
+
+	lock       sync.RWMutex
+	index      *nlp.VectorIndex
+	lastCheck  int64
+	rebuilding int32
+}
+
+// NewSemanticMatch loads the vector index from indexFile if it was built by
+// the same embedder from the stored questions, otherwise builds it from the
+// storage and saves it into indexFile. The index is rebuilt in background
+// once the number of the stored questions changes, or by Refresh once the
+// questions change. An empty indexFile keeps the index in memory only.
+func NewSemanticMatch(storage storage.StorageAdapter, embedder nlp.Embedder, indexFile string,
+	tops int) (LogicAdapter, error) {
+	match := &semanticMatch{
+		storage:   storage,
+		embedder:  embedder,
+		indexFile: indexFile,
+		tops:      tops,
+	}
+
+	if len(indexFile) > 0 {
+		index, err := nlp.LoadVectorIndex(indexFile, embedder)
+		if err == nil && index.Digest() == nlp.KeysDigest(storage.Keys()) {
+			match.index = index
+			return match, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("%s: stored questions changed", indexFile)
+		}
+		fmt.Printf("rebuilding vector index: %v\n", err)
+	}
+
+	if err := match.rebuild(); err != nil {
+		return nil, err
+	}
+
+	return match, nil
+}
+
+func (match *semanticMatch) CanProcess(string) bool {
+	return true
+}
+
+func (match *semanticMatch) Process(text string) []Answer {
+	match.refreshIfStale()
+
+	match.lock.RLock()
+	index := match.index
+	match.lock.RUnlock()
+
+	keys := index.Search(match.embedder.Embed(text), match.tops)
+	if match.verbose {
+		fmt.Println("matched size:", len(keys))
+		for _, key := range keys {
+			fmt.Printf("\t%s\t%.3f\n", key.Key, key.Score)
+		}
+	}
+
+	var answers []Answer
+	for _, key := range keys {
+		if key.Score <= 0 {
+			continue
+		}
+
+		if responses, ok := match.storage.Find(key.Key); ok && len(responses) > 0 {
+			answer := newAnswer(key.Key, topResponses(responses, 1)[0], key.Score, "semantic")
+			answer.Scores = map[string]float32{
+				"cosine": key.Score,
+			}
+			answers = append(answers, answer)
+		}
+	}
+
+	return answers
+}
+
+func (match *semanticMatch) SetVerbose() {
+	match.verbose = true
+}
+
+func (match *semanticMatch) rebuild() error {
+	index := nlp.BuildVectorIndex(match.embedder, match.storage.Keys())
+
+	match.lock.Lock()
+	match.index = index
+	match.lock.Unlock()
+
+	if len(match.indexFile) > 0 {
+		return index.Save(match.indexFile)
+	}
+
+	return nil
+}
+
+// Refresh rebuilds the index if the stored questions changed since it was
+// built, it's to be called after the storage is updated, as the keys of the
+// storage are digested.
+func (match *semanticMatch) Refresh() {
+	if !match.stale() || !atomic.CompareAndSwapInt32(&match.rebuilding, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&match.rebuilding, 0)
+
+	if err := match.rebuild(); err != nil {
+		fmt.Printf("error: %v\n", err)
+	}
+}
+
+// Refresh refreshes the match if it's a RefreshAdapter.
+func Refresh(match LogicAdapter) {
+	if adapter, ok := match.(RefreshAdapter); ok {
+		adapter.Refresh()
+	}
+}
+
+// refreshIfStale rebuilds the index in background if the number of the stored
+// questions changed, which is cheap enough to check on the requests.
+func (match *semanticMatch) refreshIfStale() {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&match.lastCheck)
+	if now-last < int64(staleCheckInterval) || !atomic.CompareAndSwapInt64(&match.lastCheck, last, now) {
+		return
+	}
+
+	match.lock.RLock()
+	index := match.index
+	match.lock.RUnlock()
+	if index.Len() == match.storage.Count() || !atomic.CompareAndSwapInt32(&match.rebuilding, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&match.rebuilding, 0)
+		if err := match.rebuild(); err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+	}()
+}
+
+// stale tells whether the stored questions changed since the index was built,
+// the questions replaced in place leave the number of them unchanged.
+func (match *semanticMatch) stale() bool {
+	match.lock.RLock()
+	index := match.index
+	match.lock.RUnlock()
+
+	return index.Len() != match.storage.Count() || index.Digest() != nlp.KeysDigest(match.storage.Keys())
+}
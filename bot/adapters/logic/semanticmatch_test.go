@@ -0,0 +1,108 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+	"github.com/kevwan/chatbot/bot/nlp"
+)
+
+func newSemanticStore() stubStorage {
+	return stubStorage{
+		"how to restart the service": {{Answer: "restart", CorpusId: 1, Occurrence: 1}},
+		"where are the logs kept":    {{Answer: "logs", CorpusId: 2, Occurrence: 1}},
+	}
+}
+
+func TestSemanticMatchStale(t *testing.T) {
+	store := newSemanticStore()
+	adapter, err := NewSemanticMatch(store, nlp.NewNgramEmbedder(256, 1, 3), "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := adapter.(*semanticMatch)
+	if match.stale() {
+		t.Fatal("expected the index fresh after built")
+	}
+	if answers := match.Process("restart the service"); len(answers) != 1 || answers[0].CorpusId != 1 {
+		t.Fatalf("expected the nearest question answered, got %v", answers)
+	}
+
+	// the question replaced in place keeps the number of the questions
+	store.Remove("where are the logs kept")
+	store.Update("how to rotate the certificates", []storage.Response{{Answer: "rotate", CorpusId: 3, Occurrence: 1}})
+	if !match.stale() {
+		t.Fatal("expected the index stale after the question replaced")
+	}
+
+	// the requests only check the number of the questions
+	match.lastCheck = 0
+	match.Process("rotate the certificates")
+	if atomic.LoadInt32(&match.rebuilding) != 0 || !match.stale() {
+		t.Fatal("expected no rebuild on a request for the question replaced in place")
+	}
+	Refresh(adapter)
+	if answers := match.Process("rotate the certificates"); len(answers) != 1 || answers[0].CorpusId != 3 {
+		t.Fatalf("expected the replaced question answered after refreshed, got %v", answers)
+	}
+
+	// the next check rebuilds in background once the number changes
+	store.Update("where are the logs kept", []storage.Response{{Answer: "logs", CorpusId: 4, Occurrence: 1}})
+	match.lastCheck = 0
+	match.Process("where are the logs kept")
+	deadline := time.Now().Add(time.Second)
+	for match.stale() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if answers := match.Process("where are the logs kept"); len(answers) != 1 || answers[0].CorpusId != 4 {
+		t.Fatalf("expected the added question answered after rebuilt, got %v", answers)
+	}
+}
+
+func TestSemanticMatchReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index.ann")
+	embedder := nlp.NewNgramEmbedder(256, 1, 3)
+	store := newSemanticStore()
+	if _, err := NewSemanticMatch(store, embedder, file, 1); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the index of the same questions is loaded, not rebuilt
+	adapter, err := NewSemanticMatch(store, embedder, file, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(file); err != nil || !info.ModTime().Equal(saved.ModTime()) {
+		t.Fatalf("expected the index file kept, got %v", err)
+	}
+	if adapter.(*semanticMatch).stale() {
+		t.Fatal("expected the loaded index fresh")
+	}
+
+	// the questions replaced while not running are found at restart
+	store.Remove("where are the logs kept")
+	store.Update("how to rotate the certificates", []storage.Response{{Answer: "rotate", CorpusId: 3, Occurrence: 1}})
+	adapter, err = NewSemanticMatch(store, embedder, file, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adapter.(*semanticMatch).stale() {
+		t.Fatal("expected the index rebuilt at restart")
+	}
+	if answers := adapter.Process("rotate the certificates"); len(answers) != 1 || answers[0].CorpusId != 3 {
+		t.Fatalf("expected the replaced question answered, got %v", answers)
+	}
+
+	index, err := nlp.LoadVectorIndex(file, embedder)
+	if err != nil || index.Digest() != nlp.KeysDigest(store.Keys()) {
+		t.Fatalf("expected the rebuilt index saved, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package logic
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// maxTemplateOutput is the maximum size of a rendered answer
+const maxTemplateOutput = 64 * 1024
+
+var (
+	errTemplateOutput = errors.New("template output too large")
+	// the loops and the calls are limited at parse time, as the output limit
+	// doesn't stop the ones without output, like {{range 1000000000}}{{end}}
+	errTemplateRange = errors.New("template ranges only over the data, not nested")
+	errTemplateCall  = errors.New("template calls not allowed")
+
+	// templateFuncs are the only functions besides the builtins of
+	// text/template, none of them has side effects.
+	templateFuncs = template.FuncMap{
+		"contains":  strings.Contains,
+		"default":   defaultValue,
+		"hasPrefix": strings.HasPrefix,
+		"hasSuffix": strings.HasSuffix,
+		"join":      strings.Join,
+		"lower":     strings.ToLower,
+		"replace":   replaceAll,
+		"trim":      strings.TrimSpace,
+		"upper":     strings.ToUpper,
+	}
+)
+
+type (
+	// TemplateData is what the answer templates have access to. Question is
+	// the matched question and Text is the question asked, Groups are the
+	// groups captured by the regular expression of a rule, Groups[0] is the
+	// whole match, and Slots are the slot values of an intent.
+	TemplateData struct {
+		Project  string
+		Question string
+		Text     string
+		Params   map[string]string
+		Groups   []string
+		Slots    map[string]string
+	}
+
+	limitedBuffer struct {
+		bytes.Buffer
+	}
+)
+
+// Render renders the content of the answer as a template with the question
+// asked and the request parameters. Contents without actions are kept as is.
+func (answer *Answer) Render(text string, params map[string]string) error {
+	if !strings.Contains(answer.Content, "{{") {
+		return nil
+	}
+
+	tmpl, err := parseTemplate(answer.Content)
+	if err != nil {
+		return err
+	}
+
+	var buf limitedBuffer
+	err = tmpl.Execute(&buf, TemplateData{
+		Project:  answer.Project,
+		Question: answer.Question,
+		Text:     text,
+		Params:   params,
+		Groups:   answer.Groups,
+		Slots:    answer.Slots,
+	})
+	if err != nil {
+		return err
+	}
+
+	answer.Content = buf.String()
+	return nil
+}
+
+func (buf *limitedBuffer) Write(p []byte) (int, error) {
+	if buf.Len()+len(p) > maxTemplateOutput {
+		return 0, errTemplateOutput
+	}
+
+	return buf.Buffer.Write(p)
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("answer").Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTemplate(tmpl.Tree.Root, false); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// checkTemplate checks that the template node runs in time linear to the data,
+// that is, ranges only over the fields of the data without nesting, and calls
+// no templates, which might recurse.
+func checkTemplate(node parse.Node, inRange bool) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			if err := checkTemplate(child, inRange); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return checkBranch(&node.BranchNode, inRange)
+	case *parse.WithNode:
+		return checkBranch(&node.BranchNode, inRange)
+	case *parse.RangeNode:
+		if inRange || !isDataField(node.Pipe) {
+			return errTemplateRange
+		}
+		return checkBranch(&node.BranchNode, true)
+	case *parse.TemplateNode:
+		return errTemplateCall
+	}
+
+	return nil
+}
+
+func checkBranch(node *parse.BranchNode, inRange bool) error {
+	if err := checkTemplate(node.List, inRange); err != nil {
+		return err
+	}
+
+	return checkTemplate(node.ElseList, inRange)
+}
+
+// isDataField returns whether the pipeline is a field of the data, like .Groups
+// or $.Params, which is never a number.
+func isDataField(pipe *parse.PipeNode) bool {
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode:
+		return true
+	case *parse.VariableNode:
+		return len(arg.Ident) > 1 && arg.Ident[0] == "$"
+	default:
+		return false
+	}
+}
+
+// defaultValue returns value, or def if value is empty, as the last argument
+// of a pipeline is the value: {{.Params.env | default "test"}}.
+func defaultValue(def, value string) string {
+	if len(value) == 0 {
+		return def
+	}
+
+	return value
+}
+
+func replaceAll(s, old, new string) string {
+	return strings.Replace(s, old, new, -1)
+}
@@ -0,0 +1,93 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnswerRender(t *testing.T) {
+	tests := []struct {
+		answer Answer
+		params map[string]string
+		expect string
+		err    bool
+	}{
+		{
+			answer: Answer{Content: "plain {answer}"},
+			expect: "plain {answer}",
+		},
+		{
+			answer: Answer{Content: "{{.Project}}: {{.Params.env | default \"test\" | upper}}", Project: "dms"},
+			expect: "dms: TEST",
+		},
+		{
+			answer: Answer{Content: "{{.Project}}: {{.Params.env | default \"test\"}}", Project: "dms"},
+			params: map[string]string{"env": "prod"},
+			expect: "dms: prod",
+		},
+		{
+			answer: Answer{Content: "error {{index .Groups 1}}", Groups: []string{"code 42", "42"}},
+			expect: "error 42",
+		},
+		{
+			answer: Answer{Content: "{{if eq .Slots.env \"prod\"}}approve first{{else}}go{{end}}",
+				Slots: map[string]string{"env": "prod"}},
+			expect: "approve first",
+		},
+		{
+			answer: Answer{Content: "{{.Missing"},
+			expect: "{{.Missing",
+			err:    true,
+		},
+		{
+			answer: Answer{Content: "{{range .Params}}" + strings.Repeat("x", 1024) + "{{end}}"},
+			params: makeParams(100),
+			expect: "{{range .Params}}" + strings.Repeat("x", 1024) + "{{end}}",
+			err:    true,
+		},
+		{
+			answer: Answer{Content: "{{range $i, $g := .Groups}}{{$i}}={{$g}} {{end}}", Groups: []string{"a", "b"}},
+			expect: "0=a 1=b ",
+		},
+		{
+			answer: Answer{Content: "{{range 1000000000}}{{end}}"},
+			expect: "{{range 1000000000}}{{end}}",
+			err:    true,
+		},
+		{
+			answer: Answer{Content: "{{$n := 1000000000}}{{range $n}}{{end}}"},
+			expect: "{{$n := 1000000000}}{{range $n}}{{end}}",
+			err:    true,
+		},
+		{
+			answer: Answer{Content: "{{range .Params}}{{range $.Params}}{{end}}{{end}}"},
+			params: makeParams(100),
+			expect: "{{range .Params}}{{range $.Params}}{{end}}{{end}}",
+			err:    true,
+		},
+		{
+			answer: Answer{Content: "{{define \"x\"}}{{template \"x\"}}{{template \"x\"}}{{end}}{{template \"x\"}}"},
+			expect: "{{define \"x\"}}{{template \"x\"}}{{template \"x\"}}{{end}}{{template \"x\"}}",
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		answer := test.answer
+		err := answer.Render("question?", test.params)
+		if (err != nil) != test.err {
+			t.Errorf("%q: unexpected error %v", test.answer.Content, err)
+		}
+		if answer.Content != test.expect {
+			t.Errorf("%q: expect %q, got %q", test.answer.Content, test.expect, answer.Content)
+		}
+	}
+}
+
+func makeParams(n int) map[string]string {
+	params := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		params[strings.Repeat("k", i+1)] = "v"
+	}
+	return params
+}
@@ -0,0 +1,165 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+)
+
+// maxTracedCandidates is the most candidates of the closest match to trace.
+const maxTracedCandidates = 50
+
+type (
+	// Trace explains how a question is answered, the search of the closest
+	// match, the scores of its candidates, the answers of each adapter, and why
+	// the answers are chosen. The trace methods do nothing on a nil trace.
+	Trace struct {
+		Search     *storage.SearchTrace `json:"search,omitempty"`
+		Candidates []TracedCandidate    `json:"candidates,omitempty"`
+		Steps      []TraceStep          `json:"steps"`
+		Reason     string               `json:"reason"`
+	}
+
+	// TracedCandidate is a candidate question scored by the closest match, Rank
+	// starts from 1.
+	TracedCandidate struct {
+		Rank     int                `json:"rank"`
+		Question string             `json:"question"`
+		Score    float32            `json:"score"`
+		Scores   map[string]float32 `json:"scores,omitempty"`
+	}
+
+	// TraceStep is the answers given by an adapter, and the notes on them.
+	TraceStep struct {
+		Adapter string         `json:"adapter"`
+		Answers []TracedAnswer `json:"answers"`
+		Note    string         `json:"note,omitempty"`
+	}
+
+	// TracedAnswer is an answer given by an adapter.
+	TracedAnswer struct {
+		Question   string  `json:"question"`
+		Content    string  `json:"content"`
+		Confidence float32 `json:"confidence"`
+	}
+
+	// TraceAdapter is a LogicAdapter which explains how it answers into the
+	// trace, in the context of the conversation like a HistoryAdapter.
+	TraceAdapter interface {
+		LogicAdapter
+		ProcessWithTrace(text string, history []string, trace *Trace) []Answer
+	}
+)
+
+// ProcessWithTrace processes the text with the history, and explains it into
+// the trace if not nil. The answers of the matches which are not a
+// TraceAdapter are traced as a whole.
+func ProcessWithTrace(match LogicAdapter, text string, history []string, trace *Trace) []Answer {
+	if trace == nil {
+		return ProcessWithHistory(match, text, history)
+	}
+
+	if adapter, ok := match.(TraceAdapter); ok {
+		return adapter.ProcessWithTrace(text, history, trace)
+	}
+
+	answers := ProcessWithHistory(match, text, history)
+	trace.addStep(adapterName(match), answers, "")
+	return answers
+}
+
+// Explain sets the reason why the answers are chosen.
+func (trace *Trace) Explain(format string, args ...interface{}) {
+	if trace != nil {
+		trace.Reason = fmt.Sprintf(format, args...)
+	}
+}
+
+func (trace *Trace) addCandidates(questions []questionAndScore, scores func(questionAndScore) map[string]float32) {
+	if trace == nil {
+		return
+	}
+
+	for i, question := range questions {
+		if i == maxTracedCandidates {
+			break
+		}
+
+		trace.Candidates = append(trace.Candidates, TracedCandidate{
+			Rank:     i + 1,
+			Question: question.question,
+			Score:    question.score,
+			Scores:   scores(question),
+		})
+	}
+}
+
+func (trace *Trace) addStep(adapter string, answers []Answer, note string) {
+	if trace == nil {
+		return
+	}
+
+	step := TraceStep{
+		Adapter: adapter,
+		Answers: make([]TracedAnswer, 0, len(answers)),
+		Note:    note,
+	}
+	for _, answer := range answers {
+		step.Answers = append(step.Answers, TracedAnswer{
+			Question:   answer.Question,
+			Content:    answer.Content,
+			Confidence: answer.Confidence,
+		})
+	}
+	trace.Steps = append(trace.Steps, step)
+}
+
+// note appends a note to the last step of the adapter.
+func (trace *Trace) note(adapter, format string, args ...interface{}) {
+	if trace == nil {
+		return
+	}
+
+	for i := len(trace.Steps) - 1; i >= 0; i-- {
+		if trace.Steps[i].Adapter == adapter {
+			if len(trace.Steps[i].Note) > 0 {
+				trace.Steps[i].Note += "; "
+			}
+			trace.Steps[i].Note += fmt.Sprintf(format, args...)
+			return
+		}
+	}
+}
+
+func (trace *Trace) searchTrace() *storage.SearchTrace {
+	if trace == nil {
+		return nil
+	}
+
+	if trace.Search == nil {
+		trace.Search = new(storage.SearchTrace)
+	}
+	return trace.Search
+}
+
+// adapterName returns the name that the adapter gives its answers.
+func adapterName(match LogicAdapter) string {
+	switch match.(type) {
+	case *closestMatch:
+		return "closest"
+	case *comboMatch:
+		return "combo"
+	case *defaultMatch:
+		return "default"
+	case *exactMatch:
+		return "exact"
+	case *intentMatch:
+		return "intent"
+	case *rulesMatch:
+		return "rules"
+	case *semanticMatch:
+		return "semantic"
+	default:
+		return fmt.Sprintf("%T", match)
+	}
+}
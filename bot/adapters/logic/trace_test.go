@@ -0,0 +1,39 @@
+package logic
+
+import "testing"
+
+func TestProcessWithTrace(t *testing.T) {
+	closest := stubMatch{
+		{Question: "a?", Content: "a", Confidence: 0.4, Adapter: "closest"},
+	}
+	semantic := stubMatch{
+		{Question: "b?", Content: "b", Confidence: 0.9, Adapter: "semantic"},
+	}
+	match := NewFallbackMatch(0.5, closest, semantic)
+
+	var trace Trace
+	answers := ProcessWithTrace(match, "question", nil, &trace)
+	if len(answers) != 1 || answers[0].Content != "b" {
+		t.Fatalf("expected the fallback answer, got %v", answers)
+	}
+	if len(trace.Steps) != 3 {
+		t.Fatalf("expected 3 steps traced, got %v", trace.Steps)
+	}
+	if trace.Steps[0].Note != "no answer with a confidence of at least 0.500, falling back" {
+		t.Fatalf("expected the fallback noted, got %q", trace.Steps[0].Note)
+	}
+	if step := trace.Steps[2]; step.Adapter != "combo" || len(step.Answers) != 1 ||
+		step.Answers[0].Question != "b?" {
+		t.Fatalf("expected the combined answers traced, got %v", step)
+	}
+
+	trace.Explain("answered by %s", answers[0].Adapter)
+	if trace.Reason != "answered by semantic" {
+		t.Fatalf("expected the reason explained, got %q", trace.Reason)
+	}
+
+	// a nil trace processes without tracing
+	if answers := ProcessWithTrace(match, "question", nil, nil); len(answers) != 1 {
+		t.Fatalf("expected the answers without trace, got %v", answers)
+	}
+}
@@ -0,0 +1,390 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wangbin/jiebago"
+	bolt "go.etcd.io/bbolt"
+)
+
+const openTimeout = time.Second
+
+var (
+	responsesBucket = []byte("responses")
+	indexesBucket   = []byte("indexes")
+	// the words that each key is indexed by
+	wordsBucket = []byte("words")
+	emptyValue  = []byte{}
+)
+
+// boltStorage keeps the responses and the word to question index on disk,
+// every Update and Remove only touches the affected key and its postings.
+// The words of each key are kept along, so that Remove deletes exactly the
+// postings the key was indexed by, whatever the segmentation is now.
+type boltStorage struct {
+	db        *bolt.DB
+	segmenter *jiebago.Segmenter
+	extracter *keywordExtracter
+	lock      sync.RWMutex
+	synonyms  *Synonyms
+}
+
+// NewBoltStorage opens the bolt storage with the default dictionaries.
+func NewBoltStorage(filepath string) (*boltStorage, error) {
+	return NewBoltStorageWithDictionaries(filepath, Dictionaries{})
+}
+
+// NewBoltStorageWithDictionaries opens the bolt storage which segments the
+// questions with the given dictionaries. The postings on disk are kept by
+// the words they were indexed with, so the keys indexed under other
+// dictionaries are searched by their old words, but removed cleanly.
+func NewBoltStorageWithDictionaries(filepath string, dicts Dictionaries) (*boltStorage, error) {
+	segmenter, extracter, err := loadDictionaries(dicts)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath, 0644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(responsesBucket); err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(wordsBucket); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateBucketIfNotExists(indexesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStorage{
+		db:        db,
+		segmenter: segmenter,
+		extracter: extracter,
+	}, nil
+}
+
+// BuildIndex does nothing, the indexes are maintained by Update and Remove.
+func (storage *boltStorage) BuildIndex() {
+}
+
+// Compact does nothing, removed postings are deleted in place.
+func (storage *boltStorage) Compact() {
+}
+
+func (storage *boltStorage) Close() error {
+	return storage.db.Close()
+}
+
+func (storage *boltStorage) Count() int {
+	var count int
+	storage.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(responsesBucket).Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+func (storage *boltStorage) Find(text string) ([]Response, bool) {
+	var responses []Response
+	var found bool
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(responsesBucket).Get([]byte(text))
+		if value == nil {
+			return nil
+		}
+
+		found = true
+		var err error
+		responses, err = decodeResponses(value)
+		return err
+	})
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return nil, false
+	}
+
+	return responses, found
+}
+
+func (storage *boltStorage) Keys() []string {
+	var keys []string
+	storage.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(responsesBucket).ForEach(func(key, _ []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+	})
+	return keys
+}
+
+// Search expands the key with the aliases of its terms, the postings on disk
+// are kept apart from the synonyms, so that they don't need rebuilding.
+func (storage *boltStorage) Search(key string) []string {
+	storage.lock.RLock()
+	aliases := storage.synonyms.Expand(key)
+	storage.lock.RUnlock()
+
+	matches := make(map[string]int)
+	storage.db.View(func(tx *bolt.Tx) error {
+		indexes := tx.Bucket(indexesBucket)
+		collected := make(map[string]bool)
+		collector := func(word string) {
+			if collected[word] {
+				return
+			}
+			collected[word] = true
+
+			postings := indexes.Bucket([]byte(word))
+			if postings == nil {
+				return
+			}
+
+			postings.ForEach(func(question, _ []byte) error {
+				matches[string(question)]++
+				return nil
+			})
+		}
+
+		if len([]rune(key)) > thresholdForKeywords {
+			tags := storage.extracter.ExtractTags(key, topKeywords)
+			for i := range tags {
+				collector(tags[i].Text())
+			}
+		}
+
+		for _, alias := range aliases {
+			collector(alias)
+		}
+
+		for _, word := range englishWords(key) {
+			collector(word)
+		}
+
+		if len(matches) == 0 {
+			for word := range storage.segmenter.Cut(key, true) {
+				collector(word)
+			}
+		}
+
+		return nil
+	})
+
+	result := make([]string, 0, len(matches))
+	for question := range matches {
+		result = append(result, question)
+	}
+
+	// more matched words first, shorter questions first on the same matches
+	sort.Slice(result, func(i, j int) bool {
+		if matches[result[i]] != matches[result[j]] {
+			return matches[result[i]] > matches[result[j]]
+		}
+		return len(result[i]) < len(result[j])
+	})
+	if len(result) > maxSearchResults {
+		result = result[:maxSearchResults]
+	}
+
+	return result
+}
+
+func (storage *boltStorage) Remove(text string) {
+	err := storage.db.Update(func(tx *bolt.Tx) error {
+		responses := tx.Bucket(responsesBucket)
+		if responses.Get([]byte(text)) == nil {
+			return nil
+		}
+
+		if err := responses.Delete([]byte(text)); err != nil {
+			return err
+		}
+
+		words, err := storage.indexedWords(tx, text)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(wordsBucket).Delete([]byte(text)); err != nil {
+			return err
+		}
+
+		indexes := tx.Bucket(indexesBucket)
+		for _, word := range words {
+			postings := indexes.Bucket([]byte(word))
+			if postings == nil {
+				continue
+			}
+
+			if err := postings.Delete([]byte(text)); err != nil {
+				return err
+			}
+
+			if k, _ := postings.Cursor().First(); k == nil {
+				if err := indexes.DeleteBucket([]byte(word)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+	}
+}
+
+// SetSynonyms replaces the synonyms to expand the searches with.
+func (storage *boltStorage) SetSynonyms(synonyms *Synonyms) {
+	storage.lock.Lock()
+	storage.synonyms = synonyms
+	storage.lock.Unlock()
+}
+
+// Sync flushes the database file, the data is already written by each update.
+func (storage *boltStorage) Sync() error {
+	return storage.db.Sync()
+}
+
+func (storage *boltStorage) Update(text string, responses []Response) {
+	value, err := encodeResponses(responses)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+
+	err = storage.db.Update(func(tx *bolt.Tx) error {
+		return storage.put(tx, text, value)
+	})
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+	}
+}
+
+// UpdateAll updates the responses of the questions in one transaction, the
+// questions with the same responses stored are not written again.
+func (storage *boltStorage) UpdateAll(responses map[string][]Response) {
+	texts := make([]string, 0, len(responses))
+	values := make(map[string][]byte, len(responses))
+	for text, each := range responses {
+		value, err := encodeResponses(each)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			continue
+		}
+		texts = append(texts, text)
+		values[text] = value
+	}
+	sort.Strings(texts)
+
+	err := storage.db.Update(func(tx *bolt.Tx) error {
+		for _, text := range texts {
+			if err := storage.put(tx, text, values[text]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+	}
+}
+
+// put writes the encoded responses of the key unless they are stored already,
+// and indexes the key if it's new.
+func (storage *boltStorage) put(tx *bolt.Tx, text string, value []byte) error {
+	bucket := tx.Bucket(responsesBucket)
+	stored := bucket.Get([]byte(text))
+	if stored != nil && bytes.Equal(stored, value) {
+		return nil
+	}
+	if err := bucket.Put([]byte(text), value); err != nil {
+		return err
+	}
+
+	// the postings of a key never change, only new keys need indexing
+	if stored != nil {
+		return nil
+	}
+
+	var words []string
+	indexes := tx.Bucket(indexesBucket)
+	for _, word := range indexWords(storage.segmenter, storage.extracter, nil, text) {
+		if len(word) == 0 {
+			continue
+		}
+		words = append(words, word)
+
+		postings, err := indexes.CreateBucketIfNotExists([]byte(word))
+		if err != nil {
+			return err
+		}
+
+		if err := postings.Put([]byte(text), emptyValue); err != nil {
+			return err
+		}
+	}
+
+	return putWords(tx, text, words)
+}
+
+func encodeResponses(responses []Response) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(responses); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// indexedWords returns the words that the key is indexed by, the keys indexed
+// before the words were kept are segmented again.
+func (storage *boltStorage) indexedWords(tx *bolt.Tx, key string) ([]string, error) {
+	value := tx.Bucket(wordsBucket).Get([]byte(key))
+	if value == nil {
+		return indexWords(storage.segmenter, storage.extracter, nil, key), nil
+	}
+
+	var words []string
+	err := gob.NewDecoder(bytes.NewReader(value)).Decode(&words)
+	return words, err
+}
+
+// putWords keeps the words that the key is indexed by.
+func putWords(tx *bolt.Tx, key string, words []string) error {
+	var value bytes.Buffer
+	if err := gob.NewEncoder(&value).Encode(words); err != nil {
+		return err
+	}
+
+	return tx.Bucket(wordsBucket).Put([]byte(key), value.Bytes())
+}
+
+// decodeResponses decodes the responses of a question, the responses written
+// before the Response type are migrated on reading.
+func decodeResponses(value []byte) ([]Response, error) {
+	var responses []Response
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&responses); err == nil {
+		return responses, nil
+	}
+
+	var legacy map[string]int
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&legacy); err != nil {
+		return nil, err
+	}
+
+	return migrateResponses(legacy), nil
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStorageRoundTrip(t *testing.T) {
+	inTempDir(t)
+	file := filepath.Join(t.TempDir(), "store.db")
+	storage, err := NewBoltStorage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := []Response{{Answer: "kubectl rollout restart", CorpusId: 1, Class: "ops", Occurrence: 2}}
+	storage.Update("restart kubernetes services", responses)
+	if err := storage.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err = NewBoltStorage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	if found, ok := storage.Find("restart kubernetes services"); !ok || !reflect.DeepEqual(found, responses) {
+		t.Fatalf("expected the responses reloaded, got %v", found)
+	}
+	if storage.Count() != 1 || !reflect.DeepEqual(storage.Keys(), []string{"restart kubernetes services"}) {
+		t.Fatalf("expected the key reloaded, got %v", storage.Keys())
+	}
+	if results := storage.Search("restarting services"); !reflect.DeepEqual(results,
+		[]string{"restart kubernetes services"}) {
+		t.Fatalf("expected the postings reloaded, got %v", results)
+	}
+}
+
+func TestBoltStorageUpdateRemoveSearch(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewBoltStorage(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	storage.Update("restart kubernetes services", []Response{{Answer: "restart", Occurrence: 1}})
+	storage.Update("deploy kubernetes clusters", []Response{{Answer: "deploy", Occurrence: 1}})
+	if results := storage.Search("kubernetes"); len(results) != 2 {
+		t.Fatalf("expected both questions found, got %v", results)
+	}
+
+	// updating a key replaces its responses, and keeps its postings
+	storage.Update("restart kubernetes services", []Response{{Answer: "rollout", Occurrence: 1}})
+	if responses, _ := storage.Find("restart kubernetes services"); len(responses) != 1 ||
+		responses[0].Answer != "rollout" {
+		t.Fatalf("expected the responses replaced, got %v", responses)
+	}
+	if storage.Count() != 2 {
+		t.Fatalf("expected 2 keys, got %d", storage.Count())
+	}
+
+	storage.Remove("restart kubernetes services")
+	if _, ok := storage.Find("restart kubernetes services"); ok {
+		t.Fatal("expected the key removed")
+	}
+	if results := storage.Search("kubernetes"); !reflect.DeepEqual(results, []string{"deploy kubernetes clusters"}) {
+		t.Fatalf("expected only the remaining question found, got %v", results)
+	}
+	if results := storage.Search("restart services"); len(results) != 0 {
+		t.Fatalf("expected the postings of the removed key deleted, got %v", results)
+	}
+	// removing a missing key does nothing
+	storage.Remove("restart kubernetes services")
+	if storage.Count() != 1 {
+		t.Fatalf("expected 1 key, got %d", storage.Count())
+	}
+}
+
+func TestBoltStorageRemoveIndexedWords(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewBoltStorage(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	// a key indexed by a word that the current segmentation doesn't give
+	storage.Update("restart services", []Response{{Answer: "restart", Occurrence: 1}})
+	err = storage.db.Update(func(tx *bolt.Tx) error {
+		postings, err := tx.Bucket(indexesBucket).CreateBucketIfNotExists([]byte("restarting"))
+		if err != nil {
+			return err
+		}
+		if err := postings.Put([]byte("restart services"), emptyValue); err != nil {
+			return err
+		}
+
+		words, err := storage.indexedWords(tx, "restart services")
+		if err != nil {
+			return err
+		}
+		return putWords(tx, "restart services", append(words, "restarting"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage.Remove("restart services")
+	storage.db.View(func(tx *bolt.Tx) error {
+		if postings := tx.Bucket(indexesBucket).Bucket([]byte("restarting")); postings != nil {
+			t.Fatal("expected the postings of the old word deleted")
+		}
+		if tx.Bucket(wordsBucket).Get([]byte("restart services")) != nil {
+			t.Fatal("expected the words of the key deleted")
+		}
+		return nil
+	})
+}
+
+func TestBoltStorageUpdateAll(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewBoltStorage(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	responses := map[string][]Response{
+		"restart kubernetes services": {{Answer: "kubectl rollout restart", CorpusId: 1, Occurrence: 1}},
+		"rotate the certificates":     {{Answer: "make certs", CorpusId: 2, Occurrence: 1}},
+	}
+	UpdateAll(storage, responses)
+	if storage.Count() != 2 {
+		t.Fatalf("expected the questions stored, got %v", storage.Keys())
+	}
+	if results := storage.Search("rotate certificates"); !reflect.DeepEqual(results, []string{"rotate the certificates"}) {
+		t.Fatalf("expected the new questions indexed, got %v", results)
+	}
+
+	// the unchanged responses write nothing but the commit, like an empty one
+	writes := func(update func()) int {
+		before := storage.db.Stats().TxStats.Write
+		update()
+		return storage.db.Stats().TxStats.Write - before
+	}
+	empty := writes(func() {
+		storage.db.Update(func(tx *bolt.Tx) error {
+			return nil
+		})
+	})
+	if unchanged := writes(func() { UpdateAll(storage, responses) }); unchanged != empty {
+		t.Fatalf("expected nothing written for the unchanged responses, got %d writes, not %d", unchanged, empty)
+	}
+
+	responses["rotate the certificates"] = []Response{{Answer: "make rotate", CorpusId: 2, Occurrence: 1}}
+	if changed := writes(func() { UpdateAll(storage, responses) }); changed <= empty {
+		t.Fatalf("expected the changed responses written, got %d writes", changed)
+	}
+	if found, _ := storage.Find("rotate the certificates"); len(found) != 1 || found[0].Answer != "make rotate" {
+		t.Fatalf("expected the changed responses stored, got %v", found)
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kevwan/chatbot/bot/nlp"
+	"github.com/tal-tech/go-zero/core/lang"
+)
+
+// DefaultClassifier routes the sentences by nlp.IsQuestion.
+var DefaultClassifier Classifier = ClassifierFunc(nlp.IsQuestion)
+
+type (
+	// Classifier tells the questions from the declarative sentences, which the
+	// separated storage keeps in different stores.
+	Classifier interface {
+		IsQuestion(sentence string) bool
+	}
+
+	// ClassifierFunc is a function that works as a Classifier.
+	ClassifierFunc func(sentence string) bool
+
+	// ClassifierRule classifies the sentences matching the regular expression
+	// Pattern, case insensitively, as questions if Question is true, or as
+	// declarative sentences otherwise.
+	ClassifierRule struct {
+		Pattern  string `json:"pattern"`
+		Question bool   `json:"question"`
+	}
+
+	ruleClassifier struct {
+		patterns  []*regexp.Regexp
+		questions []bool
+		fallback  Classifier
+	}
+
+	// RoutingMismatch is a stored sentence that some phrasings of it are
+	// routed away from.
+	RoutingMismatch struct {
+		Sentence string
+		// whether the sentence is in the question store
+		Question bool
+		// the phrasings routed to the other store
+		Phrasings []string
+	}
+)
+
+func (fn ClassifierFunc) IsQuestion(sentence string) bool {
+	return fn(sentence)
+}
+
+// NewRuleClassifier classifies the sentences by the first matching rule, and
+// the sentences matching no rule by fallback, DefaultClassifier if nil.
+func NewRuleClassifier(rules []ClassifierRule, fallback Classifier) (Classifier, error) {
+	if fallback == nil {
+		fallback = DefaultClassifier
+	}
+
+	classifier := &ruleClassifier{
+		patterns:  make([]*regexp.Regexp, 0, len(rules)),
+		questions: make([]bool, 0, len(rules)),
+		fallback:  fallback,
+	}
+	for _, rule := range rules {
+		pattern, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("classifier rule %q: %v", rule.Pattern, err)
+		}
+		classifier.patterns = append(classifier.patterns, pattern)
+		classifier.questions = append(classifier.questions, rule.Question)
+	}
+
+	return classifier, nil
+}
+
+func (classifier *ruleClassifier) IsQuestion(sentence string) bool {
+	for i, pattern := range classifier.patterns {
+		if pattern.MatchString(sentence) {
+			return classifier.questions[i]
+		}
+	}
+
+	return classifier.fallback.IsQuestion(sentence)
+}
+
+// mergeResults interleaves the search results of the stores without the
+// duplicates, so that the best results of both come first.
+func mergeResults(first, second []string) []string {
+	result := make([]string, 0, len(first)+len(second))
+	seen := make(map[string]lang.PlaceholderType, len(first)+len(second))
+	add := func(key string) {
+		if _, ok := seen[key]; !ok {
+			seen[key] = lang.Placeholder
+			result = append(result, key)
+		}
+	}
+
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			add(first[i])
+		}
+		if i < len(second) {
+			add(second[i])
+		}
+	}
+
+	return result
+}
+
+// userPhrasings returns the typical phrasings of a stored sentence that the
+// users ask with, the sentence with and without a question mark.
+func userPhrasings(sentence string) []string {
+	bare := strings.TrimRight(strings.TrimSpace(sentence), "?？ ")
+	if len(bare) == 0 {
+		return nil
+	}
+
+	return []string{bare, bare + "?"}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSeparatedStorageSearchBoth(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewSeparatedMemoryStorage("store.gob", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Update("重置密码", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.Update("怎么重置密码", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.BuildIndex()
+
+	if results := storage.Search("重置密码？"); !reflect.DeepEqual(results, []string{"怎么重置密码"}) {
+		t.Fatalf("expected only the question store searched, got %v", results)
+	}
+
+	storage.SetSearchBoth(true)
+	results := storage.Search("重置密码？")
+	if len(results) != 2 {
+		t.Fatalf("expected both stores searched, got %v", results)
+	}
+
+	mismatches := storage.RoutingMismatches()
+	if len(mismatches) != 1 || mismatches[0].Sentence != "重置密码" ||
+		!reflect.DeepEqual(mismatches[0].Phrasings, []string{"重置密码?"}) {
+		t.Fatalf("expected the declarative routed away when asked, got %v", mismatches)
+	}
+}
+
+func TestSeparatedStorageSearchFallback(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewSeparatedMemoryStorage("store.gob", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an English question stored as declarative by an earlier version
+	storage.declarativeStorage.Update("how to restart the server", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.BuildIndex()
+
+	var trace SearchTrace
+	results := storage.SearchWithTrace("how to restart the server", &trace)
+	if !reflect.DeepEqual(results, []string{"how to restart the server"}) || trace.Store != storeDeclarative {
+		t.Fatalf("expected the other store searched if nothing found, got %v in %s", results, trace.Store)
+	}
+}
+
+func TestSeparatedStorageClassifier(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewSeparatedMemoryStorage("store.gob", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.SetClassifier(ClassifierFunc(func(sentence string) bool {
+		return strings.HasPrefix(sentence, "Q:")
+	}))
+	storage.Update("Q: reset password", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.Update("reset password?", []Response{{Answer: "answer", Occurrence: 1}})
+
+	if storage.questionStorage.Count() != 1 || storage.declarativeStorage.Count() != 1 {
+		t.Fatal("expected the sentences routed by the classifier")
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	merged := mergeResults([]string{"a", "b", "c"}, []string{"b", "d"})
+	if !reflect.DeepEqual(merged, []string{"a", "b", "d", "c"}) {
+		t.Fatalf("unexpected merged results %v", merged)
+	}
+}
+
+func TestRuleClassifier(t *testing.T) {
+	classifier, err := NewRuleClassifier([]ClassifierRule{
+		{Pattern: `^(error|错误)[:：]`, Question: true},
+		{Pattern: `^note\b`},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sentence string
+		question bool
+	}{
+		{"Error: connection refused", true},
+		{"错误：找不到文件", true},
+		{"note: how to restart is in the wiki", false},
+		{"how to restart the server", true},
+		{"restart the server", false},
+	}
+	for _, test := range tests {
+		if question := classifier.IsQuestion(test.sentence); question != test.question {
+			t.Errorf("%s: expected question %t, got %t", test.sentence, test.question, question)
+		}
+	}
+
+	if _, err := NewRuleClassifier([]ClassifierRule{{Pattern: "("}}, nil); err == nil {
+		t.Fatal("expected the bad pattern reported")
+	}
+}
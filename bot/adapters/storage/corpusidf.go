@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"math"
+
+	"github.com/kevwan/chatbot/bot/nlp"
+	"github.com/tal-tech/go-zero/core/lang"
+)
+
+// idfStaleRatio is how much the number of the questions may change since the
+// IDFs were learned before Compact learns them again.
+const idfStaleRatio = 0.1
+
+// IdfAdapter is the storage that can learn the IDFs of the words from its own
+// questions, instead of weighting the keywords by the static IDF file.
+type IdfAdapter interface {
+	SetCorpusIdf(enabled bool)
+}
+
+// learnIdf computes the smoothed IDFs of the words in the keys, the words are
+// segmented and filtered the same way as the keywords.
+func (extracter *keywordExtracter) learnIdf(keys []string) nlp.IdfTable {
+	frequencies := make(map[string]int)
+	for _, key := range keys {
+		words := make(map[string]lang.PlaceholderType)
+		for word := range extracter.segmenter.Cut(key, true) {
+			if word, ok := extracter.candidate(word); ok {
+				words[word] = lang.Placeholder
+			}
+		}
+		for word := range words {
+			frequencies[word]++
+		}
+	}
+
+	idf := make(nlp.IdfTable, len(frequencies))
+	documents := float64(len(keys))
+	for word, frequency := range frequencies {
+		idf[word] = math.Log((documents+1)/(float64(frequency)+1)) + 1
+	}
+
+	return idf
+}
+
+// withIdf returns a copy of the extracter which weights the words by idf, the
+// words out of idf are weighted by its median.
+func (extracter *keywordExtracter) withIdf(idf nlp.IdfTable) *keywordExtracter {
+	return &keywordExtracter{
+		segmenter: extracter.segmenter,
+		idf:       idf,
+		medianIdf: idf.Median(),
+		stopWords: extracter.stopWords,
+	}
+}
+
+// SetCorpusIdf enables or disables learning the IDFs from the questions, the
+// indexes are rebuilt if the IDFs in use don't agree.
+func (storage *memoryStorage) SetCorpusIdf(enabled bool) {
+	storage.lock.Lock()
+	storage.learnIdf = enabled
+	rebuild := enabled != (storage.corpusIdf != nil)
+	storage.lock.Unlock()
+
+	if rebuild {
+		storage.rebuild()
+	}
+}
+
+// idfStale reports whether the questions have changed enough to learn the
+// IDFs again, it must be called with the lock held.
+func (storage *memoryStorage) idfStale() bool {
+	if !storage.learnIdf {
+		return false
+	}
+	if storage.corpusIdf == nil {
+		return true
+	}
+
+	change := math.Abs(float64(len(storage.responses) - storage.idfKeys))
+	return change > float64(storage.idfKeys)*idfStaleRatio
+}
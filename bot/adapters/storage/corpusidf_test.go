@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCorpusIdf(t *testing.T) {
+	inTempDir(t)
+	file := filepath.Join(t.TempDir(), "idf.gob")
+	storage, err := NewSeparatedMemoryStorage(file, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, question := range []string{"deploy service?", "restart service?", "rollback service?", "service logs?"} {
+		storage.Update(question, []Response{{Answer: "answer", Occurrence: 1}})
+	}
+	storage.SetCorpusIdf(true)
+
+	questions := storage.questionStorage.(*memoryStorage)
+	idf := questions.corpusIdf
+	if idf["deploy"] <= idf["service"] {
+		t.Fatalf("expected the rare word weighted more, got %v", idf)
+	}
+	if tags := questions.extracter.ExtractTags("deploy service", 1); tags[0].Text() != "deploy" {
+		t.Fatalf("expected deploy as the keyword, got %v", tags)
+	}
+
+	if err := storage.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	storage, err = NewSeparatedMemoryStorage(file, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	questions = storage.questionStorage.(*memoryStorage)
+	if len(questions.corpusIdf) != len(idf) || questions.corpusIdf["deploy"] != idf["deploy"] {
+		t.Fatalf("expected the learned IDFs restored, got %v", questions.corpusIdf)
+	}
+
+	storage.SetCorpusIdf(false)
+	if questions.corpusIdf != nil || questions.extracter != questions.staticExtracter {
+		t.Fatal("expected the IDF file used when disabled")
+	}
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kevwan/chatbot/bot/nlp"
+)
+
+const (
+	// minTypoLength is the least runes of an English word to correct typos
+	minTypoLength = 4
+	// longTypoLength is the least runes of an English word to have two typos
+	longTypoLength = 6
+)
+
+type (
+	// Correction is a term of a query that is out of the questions, and the term
+	// of the questions it's corrected to.
+	Correction struct {
+		Term       string `json:"term"`
+		Correction string `json:"correction"`
+	}
+
+	// CorrectionAdapter is the storage that corrects the misspelled terms of the
+	// queries by the terms of its questions, it returns the corrected text and
+	// the corrections, none if nothing to correct.
+	CorrectionAdapter interface {
+		Correct(text string) (string, []Correction)
+	}
+
+	// vocabulary is the indexed terms that the queries are corrected by.
+	vocabulary struct {
+		// the lower cased terms, and the indexed terms of them with the most
+		// questions
+		terms       map[string]string
+		frequencies map[string]int
+		// the lower cased Chinese terms of the readings in pinyin
+		pinyins map[string][]string
+		// the lower cased English terms
+		latins []string
+	}
+
+	candidate struct {
+		term      string
+		distance  int
+		frequency int
+	}
+)
+
+// newVocabulary builds the vocabulary of the indexes, the terms are read by
+// the pinyin table.
+func newVocabulary(indexes map[string][]int, pinyin nlp.PinyinTable) *vocabulary {
+	vocab := &vocabulary{
+		terms:       make(map[string]string, len(indexes)),
+		frequencies: make(map[string]int, len(indexes)),
+		pinyins:     make(map[string][]string),
+	}
+
+	postings := make(map[string]int, len(indexes))
+	for term, ids := range indexes {
+		lower := strings.ToLower(term)
+		if len(ids) > postings[lower] {
+			vocab.terms[lower] = term
+			postings[lower] = len(ids)
+		}
+		vocab.frequencies[lower] += len(ids)
+	}
+
+	for lower := range vocab.terms {
+		switch {
+		case strings.IndexFunc(lower, isHan) >= 0:
+			for _, reading := range pinyin.Pinyins(lower) {
+				vocab.pinyins[reading] = append(vocab.pinyins[reading], lower)
+			}
+		case isEnglishWord(lower):
+			vocab.latins = append(vocab.latins, lower)
+		}
+	}
+
+	return vocab
+}
+
+// correct returns the term of the vocabulary that the unknown term is most
+// likely meant to be, the homophones for Chinese and the typos for English.
+func (vocab *vocabulary) correct(term string, pinyin nlp.PinyinTable) (string, bool) {
+	lower := strings.ToLower(term)
+	if _, ok := vocab.terms[lower]; ok {
+		return "", false
+	}
+
+	var best *candidate
+	consider := func(each candidate) {
+		if best == nil || each.distance < best.distance ||
+			each.distance == best.distance && (each.frequency > best.frequency ||
+				each.frequency == best.frequency && each.term < best.term) {
+			best = &each
+		}
+	}
+
+	switch {
+	case strings.IndexFunc(lower, isHan) >= 0:
+		length := utf8.RuneCountInString(lower)
+		for _, reading := range pinyin.Pinyins(lower) {
+			for _, each := range vocab.pinyins[reading] {
+				if utf8.RuneCountInString(each) == length {
+					consider(candidate{term: each, frequency: vocab.frequencies[each]})
+				}
+			}
+		}
+	case isEnglishWord(lower) && len(lower) >= minTypoLength:
+		maxTypos := 1
+		if len(lower) >= longTypoLength {
+			maxTypos = 2
+		}
+		source := []rune(lower)
+		for _, each := range vocab.latins {
+			if distance, ok := nlp.TypoDistance(source, []rune(each), maxTypos); ok {
+				consider(candidate{term: each, distance: distance, frequency: vocab.frequencies[each]})
+			}
+		}
+	}
+
+	if best == nil {
+		return "", false
+	}
+
+	return vocab.terms[best.term], true
+}
+
+// Correct corrects the terms of the text out of the questions to the most
+// likely terms of the questions.
+func (storage *memoryStorage) Correct(text string) (string, []Correction) {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
+	return storage.correct(text)
+}
+
+// correct is Correct with the read lock held.
+func (storage *memoryStorage) correct(text string) (string, []Correction) {
+	vocab := storage.vocabulary()
+	var corrections []Correction
+	var builder strings.Builder
+	for _, term := range storage.correctionTerms(text, vocab) {
+		correction, ok := storage.correctTerm(term, vocab)
+		if !ok {
+			builder.WriteString(term)
+			continue
+		}
+
+		builder.WriteString(correction)
+		corrections = append(corrections, Correction{
+			Term:       term,
+			Correction: correction,
+		})
+	}
+
+	if len(corrections) == 0 {
+		return text, nil
+	}
+
+	return builder.String(), corrections
+}
+
+func (storage *memoryStorage) correctTerm(term string, vocab *vocabulary) (string, bool) {
+	if utf8.RuneCountInString(term) < 2 || storage.isStopWord(term) {
+		return "", false
+	}
+
+	return vocab.correct(term, storage.pinyin)
+}
+
+// correctionTerms segments the text into the terms to correct, which make up
+// the text. The unknown Han characters in a row are joined, as the misspelled
+// words are usually segmented into the characters.
+func (storage *memoryStorage) correctionTerms(text string, vocab *vocabulary) []string {
+	var terms []string
+	joinable := false
+	for word := range storage.segmenter.Cut(text, true) {
+		single := utf8.RuneCountInString(word) == 1 && strings.IndexFunc(word, isHan) == 0 &&
+			!storage.isStopWord(word)
+		if single {
+			_, single = vocab.terms[word]
+			single = !single
+		}
+
+		if single && joinable {
+			terms[len(terms)-1] += word
+		} else {
+			terms = append(terms, word)
+		}
+		joinable = single
+	}
+
+	return terms
+}
+
+func (storage *memoryStorage) isStopWord(term string) bool {
+	lower := strings.ToLower(strings.TrimSpace(term))
+	if _, ok := storage.extracter.stopWords[lower]; ok {
+		return true
+	}
+
+	return englishTokenizer.IsStopWord(lower)
+}
+
+// vocabulary returns the vocabulary of the indexes, which is built on demand
+// after the indexes change, it must be called with the read lock held.
+func (storage *memoryStorage) vocabulary() *vocabulary {
+	storage.vocabLock.Lock()
+	defer storage.vocabLock.Unlock()
+
+	if storage.vocab == nil {
+		storage.vocab = newVocabulary(storage.indexes, storage.pinyin)
+	}
+
+	return storage.vocab
+}
+
+// Correct corrects the text by the terms of the store it's routed to, or by
+// the other store if there is nothing to correct.
+func (storage *separatedMemoryStorage) Correct(text string) (string, []Correction) {
+	first, second := storage.route(text)
+	for _, store := range []GobStorage{first, second} {
+		if adapter, ok := store.(CorrectionAdapter); ok {
+			if corrected, corrections := adapter.Correct(text); len(corrections) > 0 {
+				return corrected, corrections
+			}
+		}
+	}
+
+	return text, nil
+}
+
+func isEnglishWord(word string) bool {
+	for _, r := range word {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+
+	return strings.IndexFunc(word, unicode.IsLetter) >= 0
+}
+
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
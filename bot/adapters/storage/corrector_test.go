@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryStorageCorrect(t *testing.T) {
+	inTempDir(t)
+	files := map[string]string{
+		"base.txt":   "怎么 1000 r\n登录 1000 v\n蓝鲸 1000 n\n平台 1000 n\n",
+		"pinyin.txt": "登 deng\n录 lu\n陆 lu\n蓝 lan\n鲸 jing\n精 jing\n平 ping\n台 tai\n",
+	}
+	for file, content := range files {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storage, err := NewMemoryStorageWithDictionaries(Dictionaries{Dict: "base.txt", Pinyin: "pinyin.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Update("怎么登录蓝鲸平台", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.Update("restart kubernetes services", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.BuildIndex()
+
+	corrected, corrections := storage.Correct("怎么登陆蓝精平台")
+	if corrected != "怎么登录蓝鲸平台" || len(corrections) != 2 {
+		t.Fatalf("expected the homophones corrected, got %s %v", corrected, corrections)
+	}
+	if _, corrections := storage.Correct("怎么登录蓝鲸平台"); corrections != nil {
+		t.Fatalf("expected nothing to correct, got %v", corrections)
+	}
+
+	corrected, _ = storage.Correct("restrat kubernetse")
+	if corrected != "restart kubernetes" {
+		t.Fatalf("expected the swapped letters corrected, got %s", corrected)
+	}
+	if results := storage.Search("restrat kubernetse"); !reflect.DeepEqual(results,
+		[]string{"restart kubernetes services"}) {
+		t.Fatalf("expected the question found by the corrections, got %v", results)
+	}
+}
+
+func TestMemoryStorageCorrectDefaultPinyin(t *testing.T) {
+	inTempDir(t)
+	if err := ioutil.WriteFile("base.txt", []byte("怎么 1000 r\n登录 1000 v\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := NewMemoryStorageWithDictionaries(Dictionaries{Dict: "base.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Update("怎么登录", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.BuildIndex()
+
+	if corrected, _ := storage.Correct("怎么登陆"); corrected != "怎么登录" {
+		t.Fatalf("expected the homophones corrected by the built-in table, got %s", corrected)
+	}
+
+	if _, err := NewMemoryStorageWithDictionaries(Dictionaries{Dict: "base.txt", Pinyin: "missing.txt"}); err == nil {
+		t.Fatal("expected the missing pinyin file to fail")
+	}
+}
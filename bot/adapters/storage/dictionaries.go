@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kevwan/chatbot/bot/nlp"
+	"github.com/tal-tech/go-zero/core/lang"
+	"github.com/wangbin/jiebago"
+	"github.com/wangbin/jiebago/analyse"
+	"github.com/wangbin/jiebago/dictionary"
+)
+
+const pinyinFile = "pinyin.txt"
+
+type (
+	// Dictionaries are the files to segment the questions and to weight their
+	// keywords with, the user dictionaries are merged on top of the base jieba
+	// dictionary in order. The empty files default to dict.txt, idf.txt and
+	// stop_words.txt in the working directory, which are only reported if
+	// missing, while the given files must be loaded. Pinyin is the pinyin table
+	// to correct the homophones of the queries, pinyin.txt if it exists or the
+	// built-in table by default.
+	Dictionaries struct {
+		Dict      string
+		UserDicts []string
+		Idf       string
+		StopWords string
+		Pinyin    string
+	}
+
+	// DictionaryAdapter is the storage that can switch to other dictionaries.
+	DictionaryAdapter interface {
+		SetDictionaries(Dictionaries) error
+	}
+
+	// keywordExtracter extracts the keywords of the sentences by TF-IDF, the
+	// same way as the jieba tag extracter, but on a segmenter with the user
+	// dictionaries.
+	keywordExtracter struct {
+		segmenter *jiebago.Segmenter
+		idf       nlp.IdfTable
+		medianIdf float64
+		stopWords nlp.StopWordSet
+	}
+
+	keyword struct {
+		text   string
+		weight float64
+	}
+)
+
+// ExtractTags returns the topK keywords of the sentence, the heaviest first.
+func (extracter *keywordExtracter) ExtractTags(sentence string, topK int) []keyword {
+	frequencies := make(map[string]float64)
+	var total float64
+	for word := range extracter.segmenter.Cut(sentence, true) {
+		word, ok := extracter.candidate(word)
+		if !ok {
+			continue
+		}
+
+		frequencies[word]++
+		total++
+	}
+
+	keywords := make([]keyword, 0, len(frequencies))
+	for word, frequency := range frequencies {
+		idf, ok := extracter.idf[word]
+		if !ok {
+			idf = extracter.medianIdf
+		}
+		keywords = append(keywords, keyword{
+			text:   word,
+			weight: idf * frequency / total,
+		})
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if keywords[i].weight != keywords[j].weight {
+			return keywords[i].weight > keywords[j].weight
+		}
+		return keywords[i].text > keywords[j].text
+	})
+	if len(keywords) > topK {
+		keywords = keywords[:topK]
+	}
+
+	return keywords
+}
+
+// candidate trims the segmented word, and reports whether it can be a keyword,
+// which has at least two runes and is not a stop word.
+func (extracter *keywordExtracter) candidate(word string) (string, bool) {
+	word = strings.TrimSpace(word)
+	if utf8.RuneCountInString(word) < 2 {
+		return word, false
+	}
+	if _, ok := extracter.stopWords[word]; ok {
+		return word, false
+	}
+
+	return word, true
+}
+
+func (word keyword) Text() string {
+	return word.text
+}
+
+// ValidateDictionary checks that the content is a dictionary that jieba can
+// load, with a word and an optional number on each line. It's to be checked
+// before loading, as jieba blocks forever on a malformed number.
+func ValidateDictionary(content string) error {
+	for i, line := range strings.Split(content, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), " ")
+		if len(fields) < 2 {
+			continue
+		}
+
+		if _, err := strconv.ParseFloat(fields[1], 64); err != nil {
+			return fmt.Errorf("line %d: bad number %q", i+1, fields[1])
+		}
+	}
+
+	return nil
+}
+
+// loadDictionaries loads the segmenter and the keyword extracter from the
+// dictionaries.
+func loadDictionaries(dicts Dictionaries) (*jiebago.Segmenter, *keywordExtracter, error) {
+	var segmenter jiebago.Segmenter
+	err := loadDictionary(dicts.Dict, nlp.DictFile, segmenter.LoadDictionary)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range dicts.UserDicts {
+		if err := segmenter.LoadUserDictionary(file); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	idf := make(nlp.IdfTable)
+	err = loadDictionary(dicts.Idf, nlp.IdfFile, func(file string) error {
+		return dictionary.LoadDictionary(idf, file)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stopWords := make(nlp.StopWordSet)
+	for word := range analyse.DefaultStopWordMap {
+		stopWords[word] = lang.Placeholder
+	}
+	err = loadDictionary(dicts.StopWords, nlp.StopWordsFile, func(file string) error {
+		return dictionary.LoadDictionary(stopWords, file)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &segmenter, &keywordExtracter{
+		segmenter: &segmenter,
+		idf:       idf,
+		medianIdf: idf.Median(),
+		stopWords: stopWords,
+	}, nil
+}
+
+// loadPinyin loads the pinyin table of the dictionaries. Without a pinyin file
+// given, pinyin.txt in the working directory is loaded if it exists, otherwise
+// the built-in table is used.
+func loadPinyin(dicts Dictionaries) (nlp.PinyinTable, error) {
+	if len(dicts.Pinyin) > 0 {
+		table, err := nlp.LoadPinyin(dicts.Pinyin)
+		if err != nil {
+			return nil, fmt.Errorf("dictionary %s: %v", dicts.Pinyin, err)
+		}
+		return table, nil
+	}
+
+	if _, err := os.Stat(pinyinFile); err != nil {
+		return nlp.DefaultPinyin(), nil
+	}
+
+	table, err := nlp.LoadPinyin(pinyinFile)
+	if err != nil {
+		fmt.Printf("error: dictionary %s: %v\n", pinyinFile, err)
+		return nlp.DefaultPinyin(), nil
+	}
+
+	return table, nil
+}
+
+// loadDictionary loads the file, or the default file if it's empty, which is
+// only reported if it can't be loaded.
+func loadDictionary(file, defaultFile string, load func(string) error) error {
+	if len(file) > 0 {
+		if err := load(file); err != nil {
+			return fmt.Errorf("dictionary %s: %v", file, err)
+		}
+		return nil
+	}
+
+	if err := load(defaultFile); err != nil {
+		fmt.Printf("error: dictionary %s: %v\n", defaultFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestMemoryStorageUserDictionaries(t *testing.T) {
+	inTempDir(t)
+	files := map[string]string{
+		"base.txt": "怎么 1000 r\n登录 1000 v\n平台 1000 n\n",
+		"user.txt": "蓝鲸平台 100000 n\n",
+	}
+	for file, content := range files {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storage, err := NewMemoryStorageWithDictionaries(Dictionaries{Dict: "base.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Update("怎么登录蓝鲸平台", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.BuildIndex()
+
+	if err := storage.SetDictionaries(Dictionaries{Dict: "base.txt", UserDicts: []string{"user.txt"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := storage.indexes["蓝鲸平台"]; !ok {
+		t.Fatalf("expected the word of the user dictionary indexed, got %v", storage.indexes)
+	}
+	if results := storage.Search("蓝鲸平台"); len(results) != 1 {
+		t.Fatalf("expected the question found, got %v", results)
+	}
+
+	if err := storage.SetDictionaries(Dictionaries{Dict: "base.txt", UserDicts: []string{"missing.txt"}}); err == nil {
+		t.Fatal("expected the missing user dictionary to fail")
+	}
+	if _, ok := storage.indexes["蓝鲸平台"]; !ok {
+		t.Fatal("expected the dictionaries kept on failure")
+	}
+}
+
+func TestValidateDictionary(t *testing.T) {
+	if err := ValidateDictionary("k8s 1000 n\r\nkubernetes\n\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateDictionary("k8s 1000 n\nkubernetes many\n"); err == nil {
+		t.Fatal("expected the bad frequency to fail")
+	}
+}
@@ -3,13 +3,14 @@ package storage
 import (
 	"encoding/gob"
 	"fmt"
+	"github.com/kevwan/chatbot/bot/nlp"
 	"github.com/tal-tech/go-zero/core/lang"
 	"github.com/tal-tech/go-zero/core/mr"
 	"github.com/wangbin/jiebago"
-	"github.com/wangbin/jiebago/analyse"
 	"math"
 	"os"
 	"sort"
+	"sync"
 )
 
 const (
@@ -18,45 +19,91 @@ const (
 	thresholdForKeywords   = 1
 	maxSearchResults       = 100
 	thresholdForStopWords  = 100
-	dictFile               = "dict.txt"
-	idfFile                = "idf.txt"
-	stopWordsFile          = "stop_words.txt"
 	generatedStopWordsFile = "stopwords.txt"
 )
 
+// englishTokenizer stems the English words of the keys and the queries, so
+// that "deploying" matches "deployed".
+var englishTokenizer = nlp.NewEnglishTokenizer()
+
 type (
 	keyChunk struct {
-		offfset int
-		keys    []string
+		offfset   int
+		keys      []string
+		segmenter *jiebago.Segmenter
+		extracter *keywordExtracter
+		synonyms  *Synonyms
+	}
+
+	// indexBuild is the indexes being built aside from the keys taken when
+	// the build started.
+	indexBuild struct {
+		keys      []string
+		chunk     keyChunk
+		learnIdf  bool
+		corpusIdf nlp.IdfTable
+		indexes   map[string][]int
 	}
 
 	memoryStorage struct {
+		lock      sync.RWMutex
+		buildLock sync.Mutex
 		writer    *gob.Encoder
 		segmenter *jiebago.Segmenter
-		extracter *analyse.TagExtracter
-		keys      []string
-		responses map[string]map[string]int
-		indexes   map[string][]int
+		extracter *keywordExtracter
+		// the extracter by the IDF file, extracter uses the learned IDFs if any
+		staticExtracter *keywordExtracter
+		keys            []string
+		keyIds          map[string]int
+		removed         map[int]lang.PlaceholderType
+		responses       map[string][]Response
+		indexes         map[string][]int
+		synonyms        *Synonyms
+		learnIdf        bool
+		// the IDFs learned from the questions, nil if not learned
+		corpusIdf nlp.IdfTable
+		// the number of the questions when the IDFs were learned
+		idfKeys int
+		// keys changed while an index is being built, nil if not building
+		journal map[string]lang.PlaceholderType
+		pinyin  nlp.PinyinTable
+		// the vocabulary of the indexes to correct the queries, nil if the
+		// indexes changed since built
+		vocab     *vocabulary
+		vocabLock sync.Mutex
 	}
 )
 
-func RestoreMemoryStorage(decoder *gob.Decoder) (*memoryStorage, error) {
-	var segmenter jiebago.Segmenter
-	segmenter.LoadDictionary(dictFile)
-	var extracter analyse.TagExtracter
-	extracter.LoadDictionary(dictFile)
-	extracter.LoadIdf(idfFile)
-	extracter.LoadStopWords(stopWordsFile)
+// RestoreMemoryStorage decodes a memory storage of the given store version,
+// the responses of the stores before version 2 are migrated. The keywords are
+// weighted by the learned IDFs if the store has them.
+func RestoreMemoryStorage(decoder *gob.Decoder, version int, dicts Dictionaries) (*memoryStorage, error) {
+	segmenter, extracter, err := loadDictionaries(dicts)
+	if err != nil {
+		return nil, err
+	}
+	pinyin, err := loadPinyin(dicts)
+	if err != nil {
+		return nil, err
+	}
 
 	var keys []string
-	responses := make(map[string]map[string]int)
+	responses := make(map[string][]Response)
 	indexes := make(map[string][]int)
 
 	if err := decoder.Decode(&keys); err != nil {
 		return nil, err
 	}
 
-	if err := decoder.Decode(&responses); err != nil {
+	if version < responsesVersion {
+		legacy := make(map[string]map[string]int)
+		if err := decoder.Decode(&legacy); err != nil {
+			return nil, err
+		}
+		for key, value := range legacy {
+			responses[key] = migrateResponses(value)
+		}
+	} else if err := decoder.Decode(&responses); err != nil {
 		return nil, err
 	}
 
@@ -64,52 +111,229 @@ func RestoreMemoryStorage(decoder *gob.Decoder) (*memoryStorage, error) {
 		return nil, err
 	}
 
-	return &memoryStorage{
-		segmenter: &segmenter,
-		extracter: &extracter,
-		keys:      keys,
-		responses: responses,
-		indexes:   indexes,
-	}, nil
+	var corpusIdf nlp.IdfTable
+	if version >= idfVersion {
+		if err := decoder.Decode(&corpusIdf); err != nil {
+			return nil, err
+		}
+	}
+
+	storage := &memoryStorage{
+		segmenter:       segmenter,
+		extracter:       extracter,
+		staticExtracter: extracter,
+		keys:            keys,
+		keyIds:          make(map[string]int, len(keys)),
+		removed:         make(map[int]lang.PlaceholderType),
+		responses:       responses,
+		indexes:         indexes,
+		pinyin:          pinyin,
+	}
+	// the learned IDFs are empty but not nil, if learned from no questions
+	if len(corpusIdf) > 0 {
+		storage.corpusIdf = corpusIdf
+		storage.idfKeys = len(responses)
+		storage.extracter = extracter.withIdf(corpusIdf)
+	}
+	for id, key := range keys {
+		if _, ok := responses[key]; ok {
+			storage.keyIds[key] = id
+		} else {
+			storage.removed[id] = lang.Placeholder
+		}
+	}
+	// stores synced without a BuildIndex have responses that are not indexed
+	for key := range responses {
+		if _, ok := storage.keyIds[key]; !ok {
+			storage.addKey(key)
+		}
+	}
+
+	return storage, nil
 }
 
+// NewMemoryStorage creates a memory storage with the default dictionaries.
 func NewMemoryStorage() *memoryStorage {
-	var segmenter jiebago.Segmenter
-	segmenter.LoadDictionary(dictFile)
-	var extracter analyse.TagExtracter
-	extracter.LoadDictionary(dictFile)
-	extracter.LoadIdf(idfFile)
-	extracter.LoadStopWords(stopWordsFile)
+	// the default dictionaries never fail to load
+	storage, _ := NewMemoryStorageWithDictionaries(Dictionaries{})
+	return storage
+}
 
-	return &memoryStorage{
-		segmenter: &segmenter,
-		extracter: &extracter,
-		responses: make(map[string]map[string]int),
-		indexes:   make(map[string][]int),
+// NewMemoryStorageWithDictionaries creates a memory storage which segments
+// the questions with the given dictionaries.
+func NewMemoryStorageWithDictionaries(dicts Dictionaries) (*memoryStorage, error) {
+	segmenter, extracter, err := loadDictionaries(dicts)
+	if err != nil {
+		return nil, err
 	}
+	pinyin, err := loadPinyin(dicts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryStorage{
+		segmenter:       segmenter,
+		extracter:       extracter,
+		staticExtracter: extracter,
+		keyIds:          make(map[string]int),
+		removed:         make(map[int]lang.PlaceholderType),
+		responses:       make(map[string][]Response),
+		indexes:         make(map[string][]int),
+		pinyin:          pinyin,
+	}, nil
 }
 
+// BuildIndex rebuilds the keys and indexes from scratch like rebuild, and
+// writes the most frequent words into stopwords.txt in the working directory,
+// which helps to pick the stop words after training.
 func (storage *memoryStorage) BuildIndex() {
-	storage.keys = storage.buildKeys()
-	storage.indexes = storage.buildIndex(storage.keys)
+	storage.rebuild()
 	storage.saveStopWords()
 }
 
+// rebuild rebuilds the keys and indexes from scratch, which also drops the
+// removed keys. The new indexes are built aside while searches and updates go
+// on with the current ones, then swapped in with the updates made in the
+// meantime replayed on top of them. The rebuilds at runtime don't write the
+// stop words, which would be shared by the projects.
+func (storage *memoryStorage) rebuild() {
+	storage.buildLock.Lock()
+	defer storage.buildLock.Unlock()
+
+	storage.swapIndex(storage.startBuild().build(storage))
+}
+
+// startBuild takes the keys to build the indexes from, and starts the journal
+// of the keys changed until the indexes are swapped in.
+func (storage *memoryStorage) startBuild() *indexBuild {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	storage.journal = make(map[string]lang.PlaceholderType)
+	return &indexBuild{
+		keys: storage.buildKeys(),
+		chunk: keyChunk{
+			segmenter: storage.segmenter,
+			extracter: storage.staticExtracter,
+			synonyms:  storage.synonyms,
+		},
+		learnIdf: storage.learnIdf,
+	}
+}
+
+// build indexes the keys, without any lock held.
+func (build *indexBuild) build(storage *memoryStorage) *indexBuild {
+	if build.learnIdf {
+		build.corpusIdf = build.chunk.extracter.learnIdf(build.keys)
+		build.chunk.extracter = build.chunk.extracter.withIdf(build.corpusIdf)
+	}
+	build.indexes = storage.buildIndex(build.keys, build.chunk)
+
+	return build
+}
+
+// swapIndex swaps in the built indexes, if built, and replays the keys in the
+// journal on top of them.
+func (storage *memoryStorage) swapIndex(build *indexBuild) {
+	keyIds := make(map[string]int, len(build.keys))
+	for id, key := range build.keys {
+		keyIds[key] = id
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if build.indexes != nil {
+		storage.keys = build.keys
+		storage.keyIds = keyIds
+		storage.indexes = build.indexes
+		storage.vocab = nil
+		storage.removed = make(map[int]lang.PlaceholderType)
+		storage.extracter = build.chunk.extracter
+		storage.corpusIdf = build.corpusIdf
+		storage.idfKeys = len(build.keys)
+		for key := range storage.journal {
+			storage.applyChange(key)
+		}
+	}
+	storage.journal = nil
+}
+
+// Compact rebuilds the indexes if any keys have been removed since the last
+// build, the postings of removed keys are kept as tombstones until then. The
+// indexes are also rebuilt to learn the IDFs again, if enabled and the
+// questions have changed enough.
+func (storage *memoryStorage) Compact() {
+	storage.lock.RLock()
+	rebuild := len(storage.removed) > 0 || storage.idfStale()
+	storage.lock.RUnlock()
+
+	if rebuild {
+		storage.rebuild()
+	}
+}
+
 func (storage *memoryStorage) Count() int {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
 	return len(storage.responses)
 }
 
-func (storage *memoryStorage) Find(text string) (map[string]int, bool) {
+// Find returns a copy of the responses, which is safe to be modified.
+func (storage *memoryStorage) Find(text string) ([]Response, bool) {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
 	value, ok := storage.responses[text]
-	return value, ok
+	if !ok {
+		return nil, false
+	}
+
+	return copyResponses(value), true
+}
+
+func (storage *memoryStorage) Keys() []string {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
+	keys := make([]string, 0, len(storage.responses))
+	for key := range storage.responses {
+		keys = append(keys, key)
+	}
+
+	return keys
 }
 
 func (storage *memoryStorage) Search(key string) []string {
+	return storage.SearchWithTrace(key, nil)
+}
+
+// SearchWithTrace is Search that explains the search into trace, if not nil.
+func (storage *memoryStorage) SearchWithTrace(key string, trace *SearchTrace) []string {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
 	ids := make(map[int]int8)
+	collected := make(map[string]lang.PlaceholderType)
 	var maxMatches int8
 	collector := func(word string) {
+		if _, ok := collected[word]; ok {
+			return
+		}
+		collected[word] = lang.Placeholder
+
+		var postings int
+		defer func() {
+			trace.addPostings(word, postings)
+		}()
 		if wordIds, ok := storage.indexes[word]; ok {
 			for _, id := range wordIds {
+				if _, ok := storage.removed[id]; ok {
+					continue
+				}
+
+				postings++
 				current := ids[id]
 				ids[id] = current + 1
 				if current+1 > maxMatches {
@@ -122,32 +346,97 @@ func (storage *memoryStorage) Search(key string) []string {
 	if len([]rune(key)) > thresholdForKeywords {
 		tags := storage.extracter.ExtractTags(key, topKeywords)
 		for i := range tags {
+			trace.addKeyword(tags[i].Text())
 			collector(tags[i].Text())
 		}
 	}
 
+	// the keys are indexed by the canonical terms of their aliases too
+	for _, canonical := range storage.synonyms.Canonicals(key) {
+		collector(canonical)
+	}
+
+	for _, word := range englishWords(key) {
+		collector(word)
+	}
+
 	if len(ids) == 0 {
 		for word := range storage.segmenter.Cut(key, true) {
 			collector(word)
 		}
 	}
 
+	// the misspelled terms have no postings, search by their corrections
+	if len(ids) == 0 {
+		_, corrections := storage.correct(key)
+		for _, correction := range corrections {
+			collector(correction.Correction)
+		}
+		trace.addCorrections(corrections)
+	}
+
+	var results []string
 	if len(ids) > maxSearchResults {
-		return storage.generateFromMoreMatches(ids, maxMatches)
+		results = storage.generateFromMoreMatches(ids, maxMatches)
 	} else {
-		return storage.generateFromLessMatches(ids)
+		results = storage.generateFromLessMatches(ids)
 	}
+	trace.addCandidates(results)
+
+	return results
 }
 
 func (storage *memoryStorage) Remove(text string) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
 	delete(storage.responses, text)
+	storage.applyChange(text)
 }
 
 func (storage *memoryStorage) SetOutput(output *gob.Encoder) {
+	storage.lock.Lock()
 	storage.writer = output
+	storage.lock.Unlock()
+}
+
+// SetDictionaries switches to the given dictionaries and rebuilds the indexes
+// with them, the current dictionaries are kept if the new ones fail to load.
+func (storage *memoryStorage) SetDictionaries(dicts Dictionaries) error {
+	segmenter, extracter, err := loadDictionaries(dicts)
+	if err != nil {
+		return err
+	}
+	pinyin, err := loadPinyin(dicts)
+	if err != nil {
+		return err
+	}
+
+	storage.lock.Lock()
+	storage.segmenter = segmenter
+	storage.extracter = extracter
+	storage.staticExtracter = extracter
+	storage.pinyin = pinyin
+	storage.vocab = nil
+	storage.lock.Unlock()
+
+	storage.rebuild()
+	return nil
+}
+
+// SetSynonyms replaces the synonyms and rebuilds the indexes with them.
+func (storage *memoryStorage) SetSynonyms(synonyms *Synonyms) {
+	storage.lock.Lock()
+	storage.synonyms = synonyms
+	storage.lock.Unlock()
+
+	storage.rebuild()
 }
 
 func (storage *memoryStorage) Sync() error {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
 	if err := storage.writer.Encode(storage.keys); err != nil {
 		return err
 	}
@@ -156,28 +445,53 @@ func (storage *memoryStorage) Sync() error {
 		return err
 	}
 
-	return storage.writer.Encode(storage.indexes)
+	if err := storage.writer.Encode(storage.indexes); err != nil {
+		return err
+	}
+
+	// an empty table is written if the IDFs are not learned
+	return storage.writer.Encode(nlp.IdfTable(storage.corpusIdf))
 }
-//TODO 大量处理字符串，性能不是很好，后期考虑优化
-func (storage *memoryStorage) Update(text string, responses map[string]int) {
 
-	storage.responses[text]=responses
-	//titles := strings.Split(text, "|")
-	//if len(titles) == 1 {
-	//	titles = strings.Split(text, "｜")
-	//}
-	//for _, title := range titles {
-	//	for k, _ := range responses {
-	//		kv := strings.Split(k, "$$$$")
-	//		if len(kv)>1 {
-	//			response := make(map[string]int)
-	//			response[fmt.Sprintf("%s$$$$%s", title, kv[1])] = 1
-	//			storage.responses[title] = response
-	//		} else {
-	//			storage.responses[title] = responses
-	//		}
-	//	}
-	//}
+func (storage *memoryStorage) Update(text string, responses []Response) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	storage.responses[text] = copyResponses(responses)
+	storage.applyChange(text)
+}
+
+// applyChange brings the indexes in line with the responses of the given key,
+// it must be called with the write lock held.
+func (storage *memoryStorage) applyChange(key string) {
+	if storage.journal != nil {
+		storage.journal[key] = lang.Placeholder
+	}
+
+	id, indexed := storage.keyIds[key]
+	if _, ok := storage.responses[key]; !ok {
+		if indexed {
+			storage.removed[id] = lang.Placeholder
+		}
+	} else if indexed {
+		delete(storage.removed, id)
+	} else {
+		storage.addKey(key)
+	}
+}
+
+// addKey appends the key and adds its postings to the indexes.
+func (storage *memoryStorage) addKey(key string) {
+	id := len(storage.keys)
+	storage.keys = append(storage.keys, key)
+	storage.keyIds[key] = id
+	storage.vocab = nil
+
+	for _, word := range indexWords(storage.segmenter, storage.extracter, storage.synonyms, key) {
+		if ids, ok := storage.indexes[word]; !ok || ids[len(ids)-1] != id {
+			storage.indexes[word] = append(ids, id)
+		}
+	}
 }
 
 func (storage *memoryStorage) buildKeys() []string {
@@ -192,7 +506,9 @@ func (storage *memoryStorage) buildKeys() []string {
 	return keys
 }
 
-func (storage *memoryStorage) buildIndex(keys []string) map[string][]int {
+// buildIndex indexes the keys with the segmenter, the extracter and the
+// synonyms of the chunk.
+func (storage *memoryStorage) buildIndex(keys []string, chunk keyChunk) map[string][]int {
 	channel := make(chan interface{})
 
 	go func() {
@@ -206,6 +522,9 @@ func (storage *memoryStorage) buildIndex(keys []string) map[string][]int {
 	result, err := mr.MapReduce(func(source chan<- interface{}) {
 		chunks := splitStrings(keys, chunkSize)
 		for i := range chunks {
+			chunks[i].segmenter = chunk.segmenter
+			chunks[i].extracter = chunk.extracter
+			chunks[i].synonyms = chunk.synonyms
 			source <- chunks[i]
 		}
 	}, storage.mapper, storage.reducer)
@@ -224,6 +543,9 @@ func (storage *memoryStorage) saveStopWords() {
 	}
 	defer f.Close()
 
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
 	stopWords := make(map[int][]string)
 	for key, value := range storage.indexes {
 		stopWords[len(value)] = append(stopWords[len(value)], key)
@@ -332,16 +654,8 @@ func (storage *memoryStorage) mapper(data interface{}, writer mr.Writer, cancel
 			}
 		}
 
-		key := chunk.keys[i]
-		if len([]rune(key)) > thresholdForKeywords {
-			tags := storage.extracter.ExtractTags(key, topKeywords)
-			for i := range tags {
-				collector(tags[i].Text())
-			}
-		} else {
-			for word := range storage.segmenter.Cut(key, true) {
-				collector(word)
-			}
+		for _, word := range indexWords(chunk.segmenter, chunk.extracter, chunk.synonyms, chunk.keys[i]) {
+			collector(word)
 		}
 	}
 
@@ -379,6 +693,37 @@ func (storage *memoryStorage) reducer(input <-chan interface{}, writer mr.Writer
 	writer.Write(result)
 }
 
+// indexWords returns the words that a key is indexed by, the keywords for long
+// keys and all segmented words for short ones, along with the canonical terms
+// of the aliases and the English word stems in the key.
+func indexWords(segmenter *jiebago.Segmenter, extracter *keywordExtracter, synonyms *Synonyms,
+	key string) []string {
+	var words []string
+	if len([]rune(key)) > thresholdForKeywords {
+		tags := extracter.ExtractTags(key, topKeywords)
+		for i := range tags {
+			words = append(words, tags[i].Text())
+		}
+	} else {
+		for word := range segmenter.Cut(key, true) {
+			words = append(words, word)
+		}
+	}
+
+	words = append(words, synonyms.Canonicals(key)...)
+	return append(words, englishWords(key)...)
+}
+
+// englishWords returns the stems of the English words in the key, nothing for
+// Chinese keys, whose few English words are keywords already.
+func englishWords(key string) []string {
+	if language := nlp.DetectLanguage(key); language == nlp.Chinese || language == nlp.UnknownLanguage {
+		return nil
+	}
+
+	return englishTokenizer.Tokenize(key)
+}
+
 func splitStrings(slice []string, size int) []*keyChunk {
 	var result []*keyChunk
 	count := len(slice)
@@ -408,8 +753,8 @@ func (storage *memoryStorage) print() {
 	fmt.Println("Responses:")
 	for key, value := range storage.responses {
 		fmt.Printf("\t%s:\n", key)
-		for text, occurrence := range value {
-			fmt.Printf("\t\t%s:\t%d\n", text, occurrence)
+		for _, response := range value {
+			fmt.Printf("\t\t%s:\t%d\n", response.Answer, response.Occurrence)
 		}
 	}
 
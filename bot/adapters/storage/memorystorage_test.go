@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func inTempDir(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(dir)
+	})
+}
+
+func TestMemoryStorageConcurrentAccess(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	for i := 0; i < 100; i++ {
+		storage.Update(fmt.Sprintf("question %d", i), []Response{{Answer: "answer", Occurrence: 1}})
+	}
+	storage.BuildIndex()
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 100; i < 200; i++ {
+			storage.Update(fmt.Sprintf("question %d", i), []Response{{Answer: "answer", Occurrence: 1}})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			storage.Remove(fmt.Sprintf("question %d", i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			storage.Search("question")
+			if responses, ok := storage.Find(fmt.Sprintf("question %d", i)); ok {
+				responses[0].Occurrence++
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			storage.BuildIndex()
+		}
+	}()
+	wg.Wait()
+	storage.Compact()
+
+	if count := storage.Count(); count != 150 {
+		t.Fatalf("expected 150 responses, got %d", count)
+	}
+	if len(storage.keys) != 150 || len(storage.removed) != 0 {
+		t.Fatalf("expected 150 keys without removed, got %d and %d", len(storage.keys), len(storage.removed))
+	}
+	for i := 0; i < 200; i++ {
+		responses, ok := storage.Find(fmt.Sprintf("question %d", i))
+		if ok != (i >= 50) {
+			t.Fatalf("question %d: unexpected existence %t", i, ok)
+		}
+		if ok && responses[0].Occurrence != 1 {
+			t.Fatalf("question %d: responses modified through Find", i)
+		}
+	}
+}
+
+func TestMemoryStorageEnglishStems(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	storage.Update("How do I restart deployed services", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.Update("Where are the logs", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.BuildIndex()
+
+	results := storage.Search("restarting a service")
+	if len(results) == 0 || results[0] != "How do I restart deployed services" {
+		t.Fatalf("expected the question found by the word stems, got %v", results)
+	}
+}
+
+func TestSeparatedStorageFindsEitherStore(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewSeparatedMemoryStorage("store.gob", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stores trained before the English questions were detected had them as
+	// declaratives
+	storage.declarativeStorage.Update("How do I restart it", []Response{{Answer: "answer", Occurrence: 1}})
+	if _, ok := storage.Find("How do I restart it"); !ok {
+		t.Fatal("expected the question found in the declarative store")
+	}
+
+	storage.Remove("How do I restart it")
+	if _, ok := storage.Find("How do I restart it"); ok {
+		t.Fatal("expected the question removed")
+	}
+}
+
+func TestMemoryStorageUpdateWithoutBuildIndex(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	storage.Update("how to restart the service", []Response{{Answer: "restart", Occurrence: 1}})
+	storage.BuildIndex()
+	storage.Update("where to find the logs", []Response{{Answer: "logs", Occurrence: 1}})
+
+	results := storage.Search("find the logs")
+	if len(results) == 0 || results[0] != "where to find the logs" {
+		t.Fatalf("expected the updated question found without BuildIndex, got %v", results)
+	}
+	if len(storage.keys) != 2 {
+		t.Fatalf("expected the key appended, got %v", storage.keys)
+	}
+}
+
+func TestMemoryStorageRemoveTombstones(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	storage.Update("how to restart the service", []Response{{Answer: "restart", Occurrence: 1}})
+	storage.Update("where to find the logs", []Response{{Answer: "logs", Occurrence: 1}})
+	storage.BuildIndex()
+
+	storage.Remove("where to find the logs")
+	if results := storage.Search("find the logs"); contains(results, "where to find the logs") {
+		t.Fatalf("expected the removed question not found, got %v", results)
+	}
+	if len(storage.keys) != 2 || len(storage.removed) != 1 {
+		t.Fatalf("expected the removed key kept as a tombstone, got %d keys and %d removed",
+			len(storage.keys), len(storage.removed))
+	}
+
+	// updating a removed key revives its postings
+	storage.Update("where to find the logs", []Response{{Answer: "logs", Occurrence: 1}})
+	if results := storage.Search("find the logs"); !contains(results, "where to find the logs") {
+		t.Fatalf("expected the question found again, got %v", results)
+	}
+	if len(storage.keys) != 2 || len(storage.removed) != 0 {
+		t.Fatalf("expected the tombstone revived, got %d keys and %d removed",
+			len(storage.keys), len(storage.removed))
+	}
+}
+
+func TestMemoryStorageCompact(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	storage.Update("how to restart the service", []Response{{Answer: "restart", Occurrence: 1}})
+	storage.Update("where to find the logs", []Response{{Answer: "logs", Occurrence: 1}})
+	storage.BuildIndex()
+
+	// nothing removed, nothing to compact
+	keys := storage.keys
+	storage.Compact()
+	if &storage.keys[0] != &keys[0] {
+		t.Fatal("expected the indexes kept without removed keys")
+	}
+
+	storage.Remove("where to find the logs")
+	storage.Compact()
+	if len(storage.keys) != 1 || len(storage.removed) != 0 {
+		t.Fatalf("expected the tombstones dropped, got %d keys and %d removed",
+			len(storage.keys), len(storage.removed))
+	}
+	for word, ids := range storage.indexes {
+		for _, id := range ids {
+			if id != 0 {
+				t.Fatalf("expected only the kept key indexed, %s has %v", word, ids)
+			}
+		}
+	}
+	if results := storage.Search("restart the service"); !contains(results, "how to restart the service") {
+		t.Fatalf("expected the kept question found, got %v", results)
+	}
+}
+
+func TestMemoryStorageReplayJournal(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	storage.Update("how to restart the service", []Response{{Answer: "restart", Occurrence: 1}})
+	storage.Update("where to find the logs", []Response{{Answer: "logs", Occurrence: 1}})
+
+	build := storage.startBuild()
+	// the changes while the indexes are being built
+	storage.Update("how to rotate the certificates", []Response{{Answer: "rotate", Occurrence: 1}})
+	storage.Remove("where to find the logs")
+	if len(storage.journal) != 2 {
+		t.Fatalf("expected the changes journaled, got %v", storage.journal)
+	}
+	storage.swapIndex(build.build(storage))
+
+	if storage.journal != nil {
+		t.Fatal("expected the journal dropped after the swap")
+	}
+	if results := storage.Search("rotate the certificates"); !contains(results, "how to rotate the certificates") {
+		t.Fatalf("expected the question updated during the build found, got %v", results)
+	}
+	if results := storage.Search("find the logs"); contains(results, "where to find the logs") {
+		t.Fatalf("expected the question removed during the build not found, got %v", results)
+	}
+	if results := storage.Search("restart the service"); !contains(results, "how to restart the service") {
+		t.Fatalf("expected the untouched question found, got %v", results)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, each := range values {
+		if each == value {
+			return true
+		}
+	}
+
+	return false
+}
+func TestMemoryStorageRebuildsWithoutStopWords(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	storage.Update("how to restart the service", []Response{{Answer: "restart", Occurrence: 1}})
+	storage.Update("where to find the logs", []Response{{Answer: "logs", Occurrence: 1}})
+
+	// the rebuilds at runtime
+	storage.SetSynonyms(nil)
+	storage.SetCorpusIdf(true)
+	storage.Remove("where to find the logs")
+	storage.Compact()
+	if err := storage.SetDictionaries(Dictionaries{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(generatedStopWordsFile); !os.IsNotExist(err) {
+		t.Fatalf("expected no stop words written by the rebuilds at runtime, got %v", err)
+	}
+
+	storage.BuildIndex()
+	if _, err := os.Stat(generatedStopWordsFile); err != nil {
+		t.Fatalf("expected the stop words written by BuildIndex, got %v", err)
+	}
+}
+
+func TestSeparatedStorageUpdateMovesStore(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewSeparatedMemoryStorage("store.gob", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.declarativeStorage.Update("How do I restart it", []Response{{Answer: "old", Occurrence: 1}})
+
+	storage.Update("How do I restart it", []Response{{Answer: "new", Occurrence: 1}})
+	if _, ok := storage.declarativeStorage.Find("How do I restart it"); ok {
+		t.Fatal("expected the stale copy removed from the declarative store")
+	}
+	responses, ok := storage.questionStorage.Find("How do I restart it")
+	if !ok || responses[0].Answer != "new" {
+		t.Fatalf("expected the question updated in the question store, got %v", responses)
+	}
+	if count := storage.Count(); count != 1 {
+		t.Fatalf("expected 1 sentence, got %d", count)
+	}
+}
+
+func TestSeparatedStorageConcurrentSync(t *testing.T) {
+	inTempDir(t)
+	storage, err := NewSeparatedMemoryStorage("store.gob", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		storage.Update(fmt.Sprintf("question %d?", i), []Response{{Answer: "answer", Occurrence: 1}})
+		storage.Update(fmt.Sprintf("sentence %d", i), []Response{{Answer: "answer", Occurrence: 1}})
+	}
+	storage.BuildIndex()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := storage.Sync(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			storage.SetSearchBoth(i%2 == 0)
+			storage.SetClassifier(nil)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			storage.Search("question?")
+			storage.RoutingMismatches()
+		}
+	}()
+	wg.Wait()
+
+	restored, err := NewSeparatedMemoryStorage("store.gob", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.questionStorage.Count() != 100 || restored.declarativeStorage.Count() != 100 {
+		t.Fatalf("expected both stores restored, got %d questions and %d declaratives",
+			restored.questionStorage.Count(), restored.declarativeStorage.Count())
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kevwan/chatbot/bot/rich"
+)
+
+// legacySeparator joined the question, the answer and the corpus id into the
+// responses of the database corpora in the stores before version 2.
+const legacySeparator = "$$$$"
+
+// Response is an answer of a stored question. Occurrence is the number of
+// times the answer follows the question in the trained conversations, the
+// corpus fields are only set for the answers of the database corpora, Blocks
+// is the rich content shown along with the answer.
+type Response struct {
+	Answer     string
+	CorpusId   int
+	Class      string
+	Project    string
+	Occurrence int
+	Blocks     []rich.Block
+}
+
+// AddResponse adds the occurrences of response to the same answer of the same
+// corpus in responses, or appends it if there is no such answer.
+func AddResponse(responses []Response, response Response) []Response {
+	for i := range responses {
+		if responses[i].Answer == response.Answer && responses[i].CorpusId == response.CorpusId {
+			responses[i].Occurrence += response.Occurrence
+			return responses
+		}
+	}
+
+	return append(responses, response)
+}
+
+func copyResponses(responses []Response) []Response {
+	if responses == nil {
+		return nil
+	}
+
+	result := make([]Response, len(responses))
+	copy(result, responses)
+	return result
+}
+
+// migrateResponses converts the responses of the stores before version 2,
+// which map the answers to their occurrences.
+func migrateResponses(legacy map[string]int) []Response {
+	responses := make([]Response, 0, len(legacy))
+	for answer, occurrence := range legacy {
+		response := parseLegacyResponse(answer)
+		response.Occurrence = occurrence
+		responses = AddResponse(responses, response)
+	}
+
+	return responses
+}
+
+// parseLegacyResponse parses question$$$$answer$$$$id, the answer may contain
+// the separator, the question and the id never do.
+func parseLegacyResponse(text string) Response {
+	first := strings.Index(text, legacySeparator)
+	last := strings.LastIndex(text, legacySeparator)
+	if first < 0 || first == last {
+		return Response{Answer: text}
+	}
+
+	id, err := strconv.Atoi(text[last+len(legacySeparator):])
+	if err != nil {
+		return Response{Answer: text}
+	}
+
+	return Response{
+		Answer:   text[first+len(legacySeparator) : last],
+		CorpusId: id,
+	}
+}
@@ -1,46 +1,88 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/gob"
+	"fmt"
 	"os"
-
-	"github.com/kevwan/chatbot/bot/nlp"
+	"sort"
+	"sync"
+	"time"
 )
 
 type separatedMemoryStorage struct {
-	filepath           string
+	filepath string
+	project  string
+	// syncLock serializes Sync and SetDictionaries, which share the stores
+	syncLock sync.Mutex
+	// lock guards the settings below, which are changed at runtime
+	lock               sync.RWMutex
+	backups            int
+	dicts              Dictionaries
+	classifier         Classifier
+	searchBoth         bool
 	declarativeStorage GobStorage
 	questionStorage    GobStorage
 }
 
-func NewSeparatedMemoryStorage(filepath string) (*separatedMemoryStorage, error) {
-	var declarativeStorage, questionStorage GobStorage
+// NewSeparatedMemoryStorage restores the stores from filepath if it exists,
+// both versioned and legacy store files are accepted. If the store file is
+// missing or corrupt, the newest valid backup generation is restored instead.
+// An empty project accepts stores of any project.
+func NewSeparatedMemoryStorage(filepath, project string) (*separatedMemoryStorage, error) {
+	return NewSeparatedMemoryStorageWithDictionaries(filepath, project, Dictionaries{})
+}
+
+// NewSeparatedMemoryStorageWithDictionaries is NewSeparatedMemoryStorage with
+// the stores segmenting the questions by the given dictionaries.
+func NewSeparatedMemoryStorageWithDictionaries(filepath, project string,
+	dicts Dictionaries) (*separatedMemoryStorage, error) {
+	storage := &separatedMemoryStorage{
+		filepath:   filepath,
+		project:    project,
+		backups:    defaultStoreBackups,
+		dicts:      dicts,
+		classifier: DefaultClassifier,
+	}
 
-	if _, err := os.Stat(filepath); err == nil {
-		f, err := os.Open(filepath)
-		if err != nil {
-			return nil, err
+	var restoreErr error
+	for generation := 0; ; generation++ {
+		file := generationFile(filepath, generation)
+		if _, err := os.Stat(file); err != nil {
+			// the store file itself is missing if a sync crashed while rotating
+			if generation == 0 {
+				continue
+			}
+			break
 		}
-		defer f.Close()
 
-		decoder := gob.NewDecoder(f)
-		if declarativeStorage, err = RestoreMemoryStorage(decoder); err != nil {
-			return nil, err
+		err := storage.restore(file)
+		if err == nil {
+			return storage, nil
 		}
 
-		if questionStorage, err = RestoreMemoryStorage(decoder); err != nil {
-			return nil, err
+		fmt.Printf("error: %v, trying the previous generation\n", err)
+		if restoreErr == nil {
+			restoreErr = err
 		}
-	} else {
-		declarativeStorage = NewMemoryStorage()
-		questionStorage = NewMemoryStorage()
+	}
+	if restoreErr != nil {
+		return nil, restoreErr
+	}
+
+	declarativeStorage, err := NewMemoryStorageWithDictionaries(dicts)
+	if err != nil {
+		return nil, err
+	}
+
+	questionStorage, err := NewMemoryStorageWithDictionaries(dicts)
+	if err != nil {
+		return nil, err
 	}
 
-	return &separatedMemoryStorage{
-		filepath:           filepath,
-		declarativeStorage: declarativeStorage,
-		questionStorage:    questionStorage,
-	}, nil
+	storage.declarativeStorage = declarativeStorage
+	storage.questionStorage = questionStorage
+	return storage, nil
 }
 
 func (storage *separatedMemoryStorage) BuildIndex() {
@@ -48,42 +90,85 @@ func (storage *separatedMemoryStorage) BuildIndex() {
 	storage.questionStorage.BuildIndex()
 }
 
+func (storage *separatedMemoryStorage) Compact() {
+	storage.declarativeStorage.Compact()
+	storage.questionStorage.Compact()
+}
+
 func (storage *separatedMemoryStorage) Count() int {
 	return storage.declarativeStorage.Count() + storage.questionStorage.Count()
 }
 
-func (storage *separatedMemoryStorage) Find(sentence string) (map[string]int, bool) {
-	if nlp.IsQuestion(sentence) {
-		return storage.questionStorage.Find(sentence)
-	} else {
-		return storage.declarativeStorage.Find(sentence)
+// Find looks up the store the sentence is routed to first, then the other one,
+// because the stores trained before English question detection routed the
+// English questions to the declarative store.
+func (storage *separatedMemoryStorage) Find(sentence string) ([]Response, bool) {
+	first, second := storage.route(sentence)
+	if responses, ok := first.Find(sentence); ok {
+		return responses, true
 	}
+
+	return second.Find(sentence)
 }
 
+func (storage *separatedMemoryStorage) Keys() []string {
+	return append(storage.questionStorage.Keys(), storage.declarativeStorage.Keys()...)
+}
+
+// Search searches the store the sentence is routed to, or both stores with the
+// results merged if SetSearchBoth is set. Like Find, the other store is searched
+// if the routed one finds nothing, which has the sentences routed otherwise
+// before, like the English questions of the stores trained earlier.
 func (storage *separatedMemoryStorage) Search(sentence string) []string {
-	if nlp.IsQuestion(sentence) {
-		return storage.questionStorage.Search(sentence)
-	} else {
-		return storage.declarativeStorage.Search(sentence)
+	return storage.SearchWithTrace(sentence, nil)
+}
+
+// SearchWithTrace is Search that explains the search into trace, if not nil.
+func (storage *separatedMemoryStorage) SearchWithTrace(sentence string, trace *SearchTrace) []string {
+	first, second := storage.route(sentence)
+	storage.lock.RLock()
+	searchBoth := storage.searchBoth
+	storage.lock.RUnlock()
+	if trace != nil {
+		trace.Store = storage.storeName(first)
+		if searchBoth {
+			trace.Store = storeBoth
+		}
 	}
+
+	results := SearchWithTrace(first, sentence, trace)
+	if !searchBoth {
+		if len(results) > 0 {
+			return results
+		}
+
+		if trace != nil {
+			trace.Store = storage.storeName(second)
+		}
+		return SearchWithTrace(second, sentence, trace)
+	}
+
+	results = mergeResults(results, SearchWithTrace(second, sentence, trace))
+	if trace != nil {
+		trace.Candidates = results
+	}
+	return results
 }
 
+// Remove removes the sentence from both stores, it might be in either one.
 func (storage *separatedMemoryStorage) Remove(sentence string) {
-	if nlp.IsQuestion(sentence) {
-		storage.questionStorage.Remove(sentence)
-	} else {
-		storage.declarativeStorage.Remove(sentence)
-	}
+	storage.questionStorage.Remove(sentence)
+	storage.declarativeStorage.Remove(sentence)
 }
 
+// Sync saves both stores into the store file, one Sync at a time, since the
+// stores are encoded into the same payload.
 func (storage *separatedMemoryStorage) Sync() error {
-	f, err := os.Create(storage.filepath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+	storage.syncLock.Lock()
+	defer storage.syncLock.Unlock()
 
-	encoder := gob.NewEncoder(f)
+	var payload bytes.Buffer
+	encoder := gob.NewEncoder(&payload)
 
 	storage.declarativeStorage.SetOutput(encoder)
 	if err := storage.declarativeStorage.Sync(); err != nil {
@@ -91,13 +176,174 @@ func (storage *separatedMemoryStorage) Sync() error {
 	}
 
 	storage.questionStorage.SetOutput(encoder)
-	return storage.questionStorage.Sync()
+	if err := storage.questionStorage.Sync(); err != nil {
+		return err
+	}
+
+	storage.lock.RLock()
+	backups := storage.backups
+	storage.lock.RUnlock()
+	return saveStore(storage.filepath, Header{
+		Project:      storage.project,
+		BuiltAt:      time.Now(),
+		Questions:    storage.questionStorage.Count(),
+		Declaratives: storage.declarativeStorage.Count(),
+	}, payload.Bytes(), backups)
+}
+
+// SetDictionaries switches both stores to the given dictionaries.
+func (storage *separatedMemoryStorage) SetDictionaries(dicts Dictionaries) error {
+	storage.syncLock.Lock()
+	defer storage.syncLock.Unlock()
+
+	for _, store := range []GobStorage{storage.declarativeStorage, storage.questionStorage} {
+		if adapter, ok := store.(DictionaryAdapter); ok {
+			if err := adapter.SetDictionaries(dicts); err != nil {
+				return err
+			}
+		}
+	}
+
+	storage.lock.Lock()
+	storage.dicts = dicts
+	storage.lock.Unlock()
+	return nil
+}
+
+// SetCorpusIdf enables or disables learning the IDFs of both stores.
+func (storage *separatedMemoryStorage) SetCorpusIdf(enabled bool) {
+	for _, store := range []GobStorage{storage.declarativeStorage, storage.questionStorage} {
+		if adapter, ok := store.(IdfAdapter); ok {
+			adapter.SetCorpusIdf(enabled)
+		}
+	}
+}
+
+// SetSynonyms sets the synonyms of both stores.
+func (storage *separatedMemoryStorage) SetSynonyms(synonyms *Synonyms) {
+	for _, store := range []GobStorage{storage.declarativeStorage, storage.questionStorage} {
+		if adapter, ok := store.(SynonymAdapter); ok {
+			adapter.SetSynonyms(synonyms)
+		}
+	}
+}
+
+// SetBackups sets the number of previous generations kept by Sync.
+func (storage *separatedMemoryStorage) SetBackups(backups int) {
+	storage.lock.Lock()
+	storage.backups = backups
+	storage.lock.Unlock()
+}
+
+// SetClassifier sets the classifier that routes the sentences to the question
+// store or the declarative store, nil for DefaultClassifier.
+func (storage *separatedMemoryStorage) SetClassifier(classifier Classifier) {
+	if classifier == nil {
+		classifier = DefaultClassifier
+	}
+	storage.lock.Lock()
+	storage.classifier = classifier
+	storage.lock.Unlock()
+}
+
+// SetSearchBoth sets whether Search searches both stores, so that the questions
+// are found however the users phrase them.
+func (storage *separatedMemoryStorage) SetSearchBoth(searchBoth bool) {
+	storage.lock.Lock()
+	storage.searchBoth = searchBoth
+	storage.lock.Unlock()
+}
+
+// Update stores the sentence in the store it's routed to, and removes it from
+// the other one, which has it if it was routed otherwise before, like Remove.
+func (storage *separatedMemoryStorage) Update(sentence string, responses []Response) {
+	first, second := storage.route(sentence)
+	second.Remove(sentence)
+	first.Update(sentence, responses)
 }
 
-func (storage *separatedMemoryStorage) Update(sentence string, responses map[string]int) {
-	if nlp.IsQuestion(sentence) {
-		storage.questionStorage.Update(sentence, responses)
-	} else {
-		storage.declarativeStorage.Update(sentence, responses)
+// RoutingMismatches returns the stored sentences that are routed to the other
+// store when phrased with or without a question mark, which the users search
+// for in vain unless both stores are searched.
+func (storage *separatedMemoryStorage) RoutingMismatches() []RoutingMismatch {
+	storage.lock.RLock()
+	classifier := storage.classifier
+	storage.lock.RUnlock()
+
+	var mismatches []RoutingMismatch
+	check := func(store GobStorage, question bool) {
+		keys := store.Keys()
+		sort.Strings(keys)
+		for _, key := range keys {
+			var phrasings []string
+			for _, phrasing := range userPhrasings(key) {
+				if classifier.IsQuestion(phrasing) != question {
+					phrasings = append(phrasings, phrasing)
+				}
+			}
+			if len(phrasings) > 0 {
+				mismatches = append(mismatches, RoutingMismatch{
+					Sentence:  key,
+					Question:  question,
+					Phrasings: phrasings,
+				})
+			}
+		}
 	}
+
+	check(storage.questionStorage, true)
+	check(storage.declarativeStorage, false)
+	return mismatches
+}
+
+// storeName returns the name of the store in the search traces.
+func (storage *separatedMemoryStorage) storeName(store GobStorage) string {
+	if store == storage.questionStorage {
+		return storeQuestion
+	}
+
+	return storeDeclarative
+}
+
+// route returns the store the sentence is routed to, and the other one.
+func (storage *separatedMemoryStorage) route(sentence string) (GobStorage, GobStorage) {
+	storage.lock.RLock()
+	classifier := storage.classifier
+	storage.lock.RUnlock()
+	if classifier.IsQuestion(sentence) {
+		return storage.questionStorage, storage.declarativeStorage
+	}
+
+	return storage.declarativeStorage, storage.questionStorage
+}
+
+func (storage *separatedMemoryStorage) restore(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header, decoder, err := readStore(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	if len(storage.project) > 0 && len(header.Project) > 0 && header.Project != storage.project {
+		return fmt.Errorf("%s: store of project %s, not %s", file, header.Project, storage.project)
+	}
+
+	declarativeStorage, err := RestoreMemoryStorage(decoder, header.Version, storage.dicts)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	questionStorage, err := RestoreMemoryStorage(decoder, header.Version, storage.dicts)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	storage.declarativeStorage = declarativeStorage
+	storage.questionStorage = questionStorage
+	return nil
 }
@@ -1,11 +1,34 @@
 package storage
 
-type StorageAdapter interface {
-	BuildIndex()
-	Count() int
-	Find(string) (map[string]int, bool)
-	Search(string) []string
-	Remove(string)
-	Sync() error
-	Update(string, map[string]int)
+type (
+	StorageAdapter interface {
+		BuildIndex()
+		Compact()
+		Count() int
+		Find(string) ([]Response, bool)
+		Keys() []string
+		Search(string) []string
+		Remove(string)
+		Sync() error
+		Update(string, []Response)
+	}
+
+	// BatchUpdater is the storage that updates many questions at once cheaper
+	// than one by one, like in a single transaction.
+	BatchUpdater interface {
+		UpdateAll(responses map[string][]Response)
+	}
+)
+
+// UpdateAll updates the responses of the questions, in a batch if the storage
+// is a BatchUpdater, otherwise one by one.
+func UpdateAll(storage StorageAdapter, responses map[string][]Response) {
+	if updater, ok := storage.(BatchUpdater); ok {
+		updater.UpdateAll(responses)
+		return
+	}
+
+	for question, value := range responses {
+		storage.Update(question, value)
+	}
 }
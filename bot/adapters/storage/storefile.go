@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	storeMagic = "CHATBOT\x00"
+	// legacyVersion is the version of the headerless stores written before
+	// the format was versioned, they start with the gob stream directly.
+	legacyVersion = 0
+	// responsesVersion is the first version storing the responses as Response
+	responsesVersion = 2
+	// idfVersion is the first version storing the learned IDFs
+	idfVersion   = 3
+	storeVersion = idfVersion
+
+	defaultStoreBackups = 3
+)
+
+var ErrChecksumMismatch = errors.New("store checksum mismatch")
+
+// Header describes a trained store file. The file starts with storeMagic,
+// followed by the gob encoded Header and the payload of Size bytes, which is
+// the gob stream of the stores.
+type Header struct {
+	Version      int
+	Project      string
+	BuiltAt      time.Time
+	Questions    int
+	Declaratives int
+	Size         int64
+	Checksum     uint32
+}
+
+// ReadStoreHeader reads the header of the given store file and verifies the
+// checksum of its payload. Legacy stores return a header of version 0.
+func ReadStoreHeader(filepath string) (*Header, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header, _, err := readStore(f)
+	return header, err
+}
+
+func (header *Header) String() string {
+	if header.Version == legacyVersion {
+		return "legacy store without header"
+	}
+
+	return fmt.Sprintf("version: %d, project: %s, built at: %s, questions: %d, declaratives: %d, size: %d, checksum: %08x",
+		header.Version, header.Project, header.BuiltAt.Format(time.RFC3339), header.Questions,
+		header.Declaratives, header.Size, header.Checksum)
+}
+
+// readStore reads the header and verifies the payload, the returned decoder
+// reads the payload. Legacy stores are decoded from the beginning of the file.
+func readStore(r io.Reader) (*Header, *gob.Decoder, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(len(storeMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	if string(magic) != storeMagic {
+		return &Header{Version: legacyVersion}, gob.NewDecoder(reader), nil
+	}
+
+	if _, err := reader.Discard(len(storeMagic)); err != nil {
+		return nil, nil, err
+	}
+
+	// bufio.Reader is an io.ByteReader, so gob doesn't read beyond the header
+	var header Header
+	if err := gob.NewDecoder(reader).Decode(&header); err != nil {
+		return nil, nil, fmt.Errorf("bad store header: %v", err)
+	}
+
+	if header.Version > storeVersion {
+		return nil, nil, fmt.Errorf("unsupported store version: %d", header.Version)
+	}
+
+	payload := make([]byte, header.Size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, nil, fmt.Errorf("truncated store: %v", err)
+	}
+
+	if crc32.ChecksumIEEE(payload) != header.Checksum {
+		return nil, nil, ErrChecksumMismatch
+	}
+
+	return &header, gob.NewDecoder(bytes.NewReader(payload)), nil
+}
+
+// saveStore atomically replaces the store file: the store is written to a
+// temp file which is synced and then renamed over the store file. The replaced
+// store is kept as generation 1, the older ones are shifted up to backups.
+func saveStore(path string, header Header, payload []byte, backups int) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Name()
+	err = writeStore(f, header, payload)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := rotateGenerations(path, backups); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// generationFile returns the file of the given generation, 0 is the store
+// file itself and 1 is the newest backup.
+func generationFile(path string, generation int) string {
+	if generation == 0 {
+		return path
+	}
+
+	return fmt.Sprintf("%s.%d", path, generation)
+}
+
+func rotateGenerations(path string, backups int) error {
+	if backups <= 0 {
+		return nil
+	}
+
+	for generation := backups - 1; generation > 0; generation-- {
+		err := os.Rename(generationFile(path, generation), generationFile(path, generation+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	newest := generationFile(path, 1)
+	if err := os.Remove(newest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// link rather than rename, so that the store file never goes missing
+	if err := os.Link(path, newest); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return os.Rename(path, newest)
+	}
+
+	return nil
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+func writeStore(w io.Writer, header Header, payload []byte) error {
+	header.Version = storeVersion
+	header.Size = int64(len(payload))
+	header.Checksum = crc32.ChecksumIEEE(payload)
+
+	if _, err := io.WriteString(w, storeMagic); err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(w).Encode(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload)
+	return err
+}
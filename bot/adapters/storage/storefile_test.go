@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func syncQuestions(t *testing.T, file string, questions ...string) {
+	storage, err := NewSeparatedMemoryStorage(file, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, question := range questions {
+		storage.Update(question, []Response{{Answer: "answer", Occurrence: 1}})
+	}
+	if err := storage.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreFileHeader(t *testing.T) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode([]string{"question?"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeStore(&buf, Header{Project: "test", Questions: 1}, payload.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	content := buf.Bytes()
+	if !bytes.HasPrefix(content, []byte(storeMagic)) {
+		t.Fatal("expected the store to start with the magic")
+	}
+
+	header, decoder, err := readStore(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != storeVersion || header.Project != "test" || header.Questions != 1 ||
+		header.Size != int64(payload.Len()) {
+		t.Fatalf("unexpected header: %s", header)
+	}
+	var keys []string
+	if err := decoder.Decode(&keys); err != nil || !reflect.DeepEqual(keys, []string{"question?"}) {
+		t.Fatalf("expected the payload decoded, got %v, %v", keys, err)
+	}
+
+	corrupted := append([]byte(nil), content...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	if _, _, err := readStore(bytes.NewReader(corrupted)); err != ErrChecksumMismatch {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+
+	if _, _, err := readStore(bytes.NewReader(content[:len(content)-1])); err == nil ||
+		!strings.HasPrefix(err.Error(), "truncated store") {
+		t.Fatalf("expected truncated store, got %v", err)
+	}
+
+	var newer bytes.Buffer
+	newer.WriteString(storeMagic)
+	gob.NewEncoder(&newer).Encode(Header{Version: storeVersion + 1})
+	if _, _, err := readStore(&newer); err == nil ||
+		!strings.HasPrefix(err.Error(), "unsupported store version") {
+		t.Fatalf("expected unsupported version, got %v", err)
+	}
+
+	// the stores without the magic are legacy, decoded from the beginning
+	header, decoder, err = readStore(bytes.NewReader(payload.Bytes()))
+	if err != nil || header.Version != legacyVersion {
+		t.Fatalf("expected legacy header, got %v, %v", header, err)
+	}
+	keys = nil
+	if err := decoder.Decode(&keys); err != nil || !reflect.DeepEqual(keys, []string{"question?"}) {
+		t.Fatalf("expected the legacy store decoded, got %v, %v", keys, err)
+	}
+}
+
+func TestStoreFileLegacyLayout(t *testing.T) {
+	inTempDir(t)
+	const file = "legacy.gob"
+
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder := gob.NewEncoder(f)
+	for _, question := range []string{"declarative", "question?"} {
+		encoder.Encode([]string{question})
+		encoder.Encode(map[string]map[string]int{question: {question + "$$$$answer $$$$ text$$$$12": 2}})
+		encoder.Encode(map[string][]int{question: {0}})
+	}
+	f.Close()
+
+	header, err := ReadStoreHeader(file)
+	if err != nil || header.Version != legacyVersion {
+		t.Fatalf("expected legacy header, got %v, %v", header, err)
+	}
+
+	storage, err := NewSeparatedMemoryStorage(file, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses, ok := storage.Find("question?")
+	if !ok || storage.Count() != 2 {
+		t.Fatal("legacy store not restored")
+	}
+	expect := Response{Answer: "answer $$$$ text", CorpusId: 12, Occurrence: 2}
+	if len(responses) != 1 || !reflect.DeepEqual(responses[0], expect) {
+		t.Fatalf("expected migrated response %v, got %v", expect, responses)
+	}
+
+	if err := storage.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if header, err := ReadStoreHeader(file); err != nil || header.Version != storeVersion {
+		t.Fatalf("expected migrated store, got %v, %v", header, err)
+	}
+
+	storage, err = NewSeparatedMemoryStorage(file, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responses, ok := storage.Find("question?"); !ok || len(responses) != 1 || !reflect.DeepEqual(responses[0], expect) {
+		t.Fatalf("expected response %v after migration, got %v", expect, responses)
+	}
+}
+
+func TestStoreFileGenerations(t *testing.T) {
+	inTempDir(t)
+	const file = "test.gob"
+
+	syncQuestions(t, file, "first?")
+	syncQuestions(t, file, "second?")
+	syncQuestions(t, file, "third?")
+
+	header, err := ReadStoreHeader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != storeVersion || header.Project != "test" || header.Questions != 3 {
+		t.Fatalf("unexpected header: %s", header)
+	}
+	if header, err := ReadStoreHeader(generationFile(file, 1)); err != nil || header.Questions != 2 {
+		t.Fatalf("unexpected backup: %v, %v", header, err)
+	}
+
+	// corrupt the last byte of the payload, the newest backup is loaded instead
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)-1] ^= 0xff
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadStoreHeader(file); err != ErrChecksumMismatch {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+
+	storage, err := NewSeparatedMemoryStorage(file, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := storage.Count(); count != 2 {
+		t.Fatalf("expected the backup with 2 questions, got %d", count)
+	}
+
+	if _, err := NewSeparatedMemoryStorage(file, "other"); err == nil {
+		t.Fatal("expected error on store of another project")
+	}
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// Synonyms maps the aliases of the terms, such as abbreviations and jargon,
+// to the canonical terms. The aliases are matched as phrases in the lower
+// cased text, so they don't depend on how the dictionary segments them.
+type Synonyms struct {
+	canonicals map[string]string
+	groups     map[string][]string
+	// aliases are tried longest first, so the longer aliases win
+	aliases []string
+}
+
+// SynonymAdapter is the storage that expands the questions with synonyms.
+type SynonymAdapter interface {
+	SetSynonyms(*Synonyms)
+}
+
+// NewSynonyms creates the synonyms from the aliases of the canonical terms,
+// a canonical term is an alias of itself. An alias given to more than one
+// term belongs to the first term in the order of the terms.
+func NewSynonyms(groups map[string][]string) *Synonyms {
+	terms := make([]string, 0, len(groups))
+	for term := range groups {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	synonyms := &Synonyms{
+		canonicals: make(map[string]string),
+		groups:     make(map[string][]string),
+	}
+	for _, term := range terms {
+		canonical := normalizeSynonym(term)
+		if len(canonical) == 0 {
+			continue
+		}
+
+		for _, alias := range append([]string{term}, groups[term]...) {
+			alias = normalizeSynonym(alias)
+			if len(alias) == 0 {
+				continue
+			}
+			if _, ok := synonyms.canonicals[alias]; ok {
+				continue
+			}
+
+			synonyms.canonicals[alias] = canonical
+			synonyms.groups[canonical] = append(synonyms.groups[canonical], alias)
+			synonyms.aliases = append(synonyms.aliases, alias)
+		}
+	}
+	sort.SliceStable(synonyms.aliases, func(i, j int) bool {
+		return len(synonyms.aliases[i]) > len(synonyms.aliases[j])
+	})
+
+	return synonyms
+}
+
+// Len returns the number of the aliases, nil synonyms have none.
+func (synonyms *Synonyms) Len() int {
+	if synonyms == nil {
+		return 0
+	}
+
+	return len(synonyms.aliases)
+}
+
+// Canonicals returns the canonical terms of the aliases in the text.
+func (synonyms *Synonyms) Canonicals(text string) []string {
+	if synonyms.Len() == 0 {
+		return nil
+	}
+
+	var result []string
+	seen := make(map[string]bool)
+	lower := strings.ToLower(text)
+	for _, alias := range synonyms.aliases {
+		for start := 0; start < len(lower); {
+			index := strings.Index(lower[start:], alias)
+			if index < 0 {
+				break
+			}
+
+			index += start
+			end := index + len(alias)
+			if isWordBoundary(lower, index, end) {
+				canonical := synonyms.canonicals[alias]
+				if !seen[canonical] {
+					seen[canonical] = true
+					result = append(result, canonical)
+				}
+				// blank out the match, so the shorter aliases inside it don't match
+				lower = lower[:index] + strings.Repeat(" ", len(alias)) + lower[end:]
+			}
+			start = end
+		}
+	}
+
+	return result
+}
+
+// Expand returns all the aliases of the terms in the text, including the
+// canonical terms themselves.
+func (synonyms *Synonyms) Expand(text string) []string {
+	var result []string
+	for _, canonical := range synonyms.Canonicals(text) {
+		result = append(result, synonyms.groups[canonical]...)
+	}
+
+	return result
+}
+
+// isWordBoundary reports whether text[start:end] is not a part of a longer
+// latin word or number, such as "ci" in "circle".
+func isWordBoundary(text string, start, end int) bool {
+	if start > 0 && isAlphanumeric(text[start]) && isAlphanumeric(text[start-1]) {
+		return false
+	}
+	if end < len(text) && isAlphanumeric(text[end-1]) && isAlphanumeric(text[end]) {
+		return false
+	}
+
+	return true
+}
+
+func isAlphanumeric(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
+
+func normalizeSynonym(text string) string {
+	return strings.ToLower(strings.TrimSpace(text))
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSynonymsCanonicals(t *testing.T) {
+	synonyms := NewSynonyms(map[string][]string{
+		"Kubernetes": {"k8s", "kube"},
+		"持续集成":       {"ci", "CI流水线"},
+	})
+
+	tests := []struct {
+		text   string
+		expect []string
+	}{
+		{"how to deploy on K8S?", []string{"kubernetes"}},
+		{"kubernetes is down", []string{"kubernetes"}},
+		{"ci流水线失败了", []string{"持续集成"}},
+		{"circle is not ci", []string{"持续集成"}},
+		{"circle", nil},
+		{"kubectl", nil},
+	}
+	for _, test := range tests {
+		if canonicals := synonyms.Canonicals(test.text); !reflect.DeepEqual(canonicals, test.expect) {
+			t.Errorf("%s: expected %v, got %v", test.text, test.expect, canonicals)
+		}
+	}
+
+	var empty *Synonyms
+	if empty.Canonicals("k8s") != nil {
+		t.Error("nil synonyms expand nothing")
+	}
+}
+
+func TestMemoryStorageSearchSynonyms(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	storage.Update("kubernetes", []Response{{Answer: "cluster", Occurrence: 1}})
+	storage.Update("k8s", []Response{{Answer: "short", Occurrence: 1}})
+	storage.BuildIndex()
+
+	storage.SetSynonyms(NewSynonyms(map[string][]string{"kubernetes": {"k8s"}}))
+	for _, key := range []string{"k8s", "kubernetes"} {
+		if results := storage.Search(key); len(results) != 2 {
+			t.Errorf("%s: expected both questions, got %v", key, results)
+		}
+	}
+
+	storage.SetSynonyms(nil)
+	if results := storage.Search("k8s"); !reflect.DeepEqual(results, []string{"k8s"}) {
+		t.Errorf("expected only k8s without synonyms, got %v", results)
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+// The stores of the separated storage that a search goes to.
+const (
+	storeQuestion    = "question"
+	storeDeclarative = "declarative"
+	storeBoth        = "both"
+)
+
+type (
+	// SearchTrace explains a search, what the query is looked up by, and the
+	// candidates found. The trace methods do nothing on a nil trace.
+	SearchTrace struct {
+		// the store searched of the separated storage
+		Store    string   `json:"store,omitempty"`
+		Keywords []string `json:"keywords"`
+		// the terms looked up, and the number of the questions indexed by them
+		Postings    map[string]int `json:"postings"`
+		Corrections []Correction   `json:"corrections,omitempty"`
+		Candidates  []string       `json:"candidates"`
+	}
+
+	// SearchTracer is the storage that can explain its searches.
+	SearchTracer interface {
+		SearchWithTrace(key string, trace *SearchTrace) []string
+	}
+)
+
+// SearchWithTrace searches the storage with the trace if it's a SearchTracer,
+// otherwise without.
+func SearchWithTrace(storage StorageAdapter, key string, trace *SearchTrace) []string {
+	if tracer, ok := storage.(SearchTracer); ok && trace != nil {
+		return tracer.SearchWithTrace(key, trace)
+	}
+
+	results := storage.Search(key)
+	trace.addCandidates(results)
+	return results
+}
+
+func (trace *SearchTrace) addCandidates(candidates []string) {
+	if trace != nil {
+		trace.Candidates = candidates
+	}
+}
+
+func (trace *SearchTrace) addCorrections(corrections []Correction) {
+	if trace == nil {
+		return
+	}
+
+	for _, correction := range corrections {
+		duplicate := false
+		for _, each := range trace.Corrections {
+			if each == correction {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			trace.Corrections = append(trace.Corrections, correction)
+		}
+	}
+}
+
+func (trace *SearchTrace) addKeyword(keyword string) {
+	if trace == nil {
+		return
+	}
+
+	for _, each := range trace.Keywords {
+		if each == keyword {
+			return
+		}
+	}
+	trace.Keywords = append(trace.Keywords, keyword)
+}
+
+func (trace *SearchTrace) addPostings(term string, postings int) {
+	if trace == nil {
+		return
+	}
+
+	if trace.Postings == nil {
+		trace.Postings = make(map[string]int)
+	}
+	trace.Postings[term] += postings
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryStorageSearchWithTrace(t *testing.T) {
+	inTempDir(t)
+	storage := NewMemoryStorage()
+	storage.Update("restart kubernetes services", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.Update("deploy kubernetes clusters", []Response{{Answer: "answer", Occurrence: 1}})
+	storage.BuildIndex()
+
+	var trace SearchTrace
+	results := SearchWithTrace(storage, "restrat kubernetse services", &trace)
+	if !reflect.DeepEqual(results, []string{"restart kubernetes services"}) {
+		t.Fatalf("expected the question found, got %v", results)
+	}
+	if !reflect.DeepEqual(trace.Candidates, results) {
+		t.Fatalf("expected the candidates traced, got %v", trace.Candidates)
+	}
+	if trace.Postings["servic"] != 1 || trace.Postings["restrat"] != 0 {
+		t.Fatalf("expected the postings of the terms traced, got %v", trace.Postings)
+	}
+	if len(trace.Corrections) != 0 {
+		t.Fatalf("expected no corrections as the question is found, got %v", trace.Corrections)
+	}
+
+	trace = SearchTrace{}
+	SearchWithTrace(storage, "restrat kubernetse", &trace)
+	expect := []Correction{
+		{Term: "restrat", Correction: "restart"},
+		{Term: "kubernetse", Correction: "kubernetes"},
+	}
+	if !reflect.DeepEqual(trace.Corrections, expect) {
+		t.Fatalf("expected the corrections traced, got %v", trace.Corrections)
+	}
+	if trace.Postings["kubernetes"] != 2 {
+		t.Fatalf("expected the postings of the corrections traced, got %v", trace.Postings)
+	}
+}
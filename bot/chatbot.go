@@ -20,10 +20,17 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/kevwan/chatbot/bot/adapters/logic"
 	"github.com/kevwan/chatbot/bot/adapters/storage"
+	"github.com/kevwan/chatbot/bot/rich"
+	"github.com/kevwan/chatbot/bot/session"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-const mega = 1024 * 1024
+const (
+	mega        = 1024 * 1024
+	defaultTops = 5
+)
+
+var questionSeparator = regexp.MustCompile(`[|｜\r\n]+`)
 
 type ChatBot struct {
 	PrintMemStats bool
@@ -32,7 +39,17 @@ type ChatBot struct {
 	//OutputAdapter  output.OutputAdapter
 	StorageAdapter storage.StorageAdapter
 	Trainer        Trainer
+	Sessions       session.Store
+	Intents        *logic.IntentSet
+	Feedback       *logic.FeedbackSet
 	Config         Config
+	synonymLock    sync.Mutex
+	dictLock       sync.Mutex
+	// the synonyms applied to the storage, nil if not loaded yet
+	synonyms    map[string][]string
+	clusterLock sync.Mutex
+	// the clusters of the unanswered questions, nil if not mined yet
+	clusters []UnansweredCluster
 }
 
 type CORPUS_TYPE int
@@ -77,7 +94,7 @@ func (f *ChatBotFactory) Init() {
 			logger.Error(err)
 			panic(err)
 		}
-		err = engine.Sync2(&Corpus{}, &Project{}, &Feedback{})
+		err = engine.Sync2(&Corpus{}, &Project{}, &Feedback{}, &Synonym{})
 		if err != nil {
 			log.Error(err)
 		}
@@ -100,12 +117,32 @@ func (f *ChatBotFactory) Init() {
 		}
 		conf.Project = project.Name
 		if _, ok := f.GetChatBot(project.Name); !ok {
-			store, _ := storage.NewSeparatedMemoryStorage(fmt.Sprintf("%s.gob", project.Name))
+			store, err := NewStorage(conf)
+			if err != nil {
+				logger.Errorf("project %s: %v", project.Name, err)
+				continue
+			}
+			intents := logic.NewIntentSet()
+			logicAdapter, err := NewLogicAdapterWithIntents(conf, store, intents, defaultTops)
+			if err != nil {
+				logger.Errorf("project %s: %v", project.Name, err)
+				continue
+			}
+			feedback := NewFeedbackSet(conf)
+			logic.SetFeedback(logicAdapter, feedback)
+			sessions, err := NewSessionStore(conf)
+			if err != nil {
+				logger.Errorf("project %s: %v", project.Name, err)
+				continue
+			}
 			chatbot := &ChatBot{
-				LogicAdapter:   logic.NewClosestMatch(store, 5),
+				LogicAdapter:   logicAdapter,
 				PrintMemStats:  false,
 				Trainer:        NewCorpusTrainer(store),
 				StorageAdapter: store,
+				Sessions:       sessions,
+				Intents:        intents,
+				Feedback:       feedback,
 				Config:         conf,
 			}
 			f.AddChatBot(project.Name, chatbot)
@@ -289,7 +326,7 @@ func (chatbot *ChatBot) Init() {
 		panic(err)
 	}
 
-	err = engine.Sync2(&Corpus{}, &Project{}, &Feedback{})
+	err = engine.Sync2(&Corpus{}, &Project{}, &Feedback{}, &Synonym{})
 	if err != nil {
 		log.Error(err)
 	}
@@ -311,6 +348,7 @@ func (chatbot *ChatBot) Init() {
 	}
 
 	go chatbot.syncCorpus()
+	go chatbot.mineUnanswered()
 
 }
 
@@ -323,12 +361,25 @@ func (chatbot *ChatBot) syncCorpus() {
 		}()
 
 		time.Sleep(time.Second * 10)
-		corpuses, err := chatbot.LoadCorpusFromDB()
+		responses, err := chatbot.LoadResponsesFromDB()
 		if err != nil {
 			log.Error(err)
 		}
 
-		if err := chatbot.Trainer.TrainWithCorpus(corpuses); err != nil {
+		if err := chatbot.Trainer.TrainWithResponses(responses); err != nil {
+			log.Error(err)
+		}
+		logic.Refresh(chatbot.LogicAdapter)
+
+		if err := chatbot.RefreshIntents(); err != nil {
+			log.Error(err)
+		}
+
+		if err := chatbot.RefreshSynonyms(); err != nil {
+			log.Error(err)
+		}
+
+		if err := chatbot.RefreshFeedback(); err != nil {
 			log.Error(err)
 		}
 
@@ -356,6 +407,8 @@ type Corpus struct {
 	QuesState        int       `json:"ques_state" xorm:"ques_state"`
 	Resp             string    `json:"resp" xorm:"resp"`
 	SubProject       string    `json:"sub_project" xorm:"sub_project"`
+	Slots            string    `json:"slots" form:"slots" xorm:"text 'slots' comment('槽位')"`
+	Rich             string    `json:"rich" form:"rich" xorm:"text 'rich' comment('富文本')"`
 }
 
 type Feedback struct {
@@ -373,7 +426,8 @@ type Feedback struct {
 	CreatedAt   time.Time `json:"created_at" xorm:"created_at created" description:"创建时间"`
 	UpdatedAt   time.Time `json:"updated_at" xorm:"updated_at updated" description:"更新时间"`
 	//DeletedAt   time.Time `xorm:"deleted_at" json:"deleted_at" description:"删除时间"`
-	Qtype int `json:"qtype" form:"qtype" xorm:"int 'qtype' comment('类型，需求，问答, 规则')"`
+	Qtype    int `json:"qtype" form:"qtype" xorm:"int 'qtype' comment('类型，需求，问答, 规则')"`
+	Resolved int `json:"resolved" form:"resolved" xorm:"int default 0 'resolved' comment('已处理')"`
 }
 
 type Project struct {
@@ -382,17 +436,53 @@ type Project struct {
 	Config    string    `json:"config" form:"config"  xorm:"text notnull 'config' comment('配置')"`
 	Status    int       `json:"status" form:"status"  xorm:"int notnull default 1 'status' comment('状态')"`
 	CreatedAt time.Time `json:"created_at" xorm:"created_at created" json:"created_at" description:"创建时间"`
-	UpdatedAt time.Time `json:"updated_at" xorm:"updated_at updated"json:"updated_at"description:"更新时间"`
+	UpdatedAt time.Time `json:"updated_at" xorm:"updated_at updated" description:"更新时间"`
 	DeletedAt time.Time `xorm:"deleted_at" json:"deleted_at" description:"删除时间"`
 	//Config Config
 }
 
 type Config struct {
-	Driver     string `json:"driver"`
-	DataSource string `json:"data_source"`
-	Project    string `json:"project"`
-	DirCorpus  string `json:"dir_corpus"`
-	StoreFile  string `json:"store_file"`
+	Driver            string                   `json:"driver"`
+	DataSource        string                   `json:"data_source"`
+	Project           string                   `json:"project"`
+	DirCorpus         string                   `json:"dir_corpus"`
+	StoreFile         string                   `json:"store_file"`
+	Storage           string                   `json:"storage"`
+	StoreBackups      int                      `json:"store_backups"`
+	Ranking           string                   `json:"ranking"`
+	Logic             string                   `json:"logic"`
+	Rules             []logic.Rule             `json:"rules"`
+	DefaultReply      string                   `json:"default_reply"`
+	MinConfidence     float32                  `json:"min_confidence"`
+	SuggestConfidence float32                  `json:"suggest_confidence"`
+	ComboStrategy     string                   `json:"combo_strategy"`
+	ComboWeights      []float32                `json:"combo_weights"`
+	SessionTTL        int                      `json:"session_ttl"`
+	SessionTurns      int                      `json:"session_turns"`
+	DictFile          string                   `json:"dict_file"`
+	UserDictFiles     []string                 `json:"user_dict_files"`
+	IdfFile           string                   `json:"idf_file"`
+	StopWordsFile     string                   `json:"stop_words_file"`
+	DictDir           string                   `json:"dict_dir"`
+	CorpusIdf         bool                     `json:"corpus_idf"`
+	SearchBoth        bool                     `json:"search_both"`
+	Classifier        string                   `json:"classifier"`
+	ClassifierRules   []storage.ClassifierRule `json:"classifier_rules"`
+	PinyinFile        string                   `json:"pinyin_file"`
+	FeedbackWeight    float32                  `json:"feedback_weight"`
+	MinAccepts        int                      `json:"min_accepts"`
+}
+
+// Response is the reply to a question, Suggestions are the answers in the low
+// confidence band, given only if there are no confident Answers. DidYouMean is
+// the question with the misspelled terms corrected, if any. Trace explains the
+// answers if asked for.
+type Response struct {
+	Answers     []logic.Answer
+	Suggestions []logic.Answer
+	DidYouMean  string
+	Corrections []storage.Correction
+	Trace       *logic.Trace
 }
 
 type JiraConf struct {
@@ -446,8 +536,11 @@ func (chatbot *ChatBot) Train(data interface{}) error {
 	}
 }
 
-func (chatbot *ChatBot) LoadCorpusFromDB() (map[string][][]string, error) {
-	results := make(map[string][][]string)
+// LoadResponsesFromDB loads the corpora of the project, keyed by each of the
+// alternative questions. The intents, which are the corpora with slots, are
+// loaded by LoadIntentsFromDB instead.
+func (chatbot *ChatBot) LoadResponsesFromDB() (map[string][]storage.Response, error) {
+	results := make(map[string][]storage.Response)
 	var rows []Corpus
 	query := Corpus{
 		Project:   chatbot.Config.Project,
@@ -458,29 +551,112 @@ func (chatbot *ChatBot) LoadCorpusFromDB() (map[string][][]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	var corpuses [][]string
-	exp, err := regexp.Compile(`[|｜\r\n]+`)
+	for _, row := range rows {
+		if len(row.Slots) > 0 {
+			continue
+		}
+
+		for _, question := range SplitQuestions(row.Question) {
+			results[question] = storage.AddResponse(results[question], row.Response())
+		}
+	}
+	return results, nil
+
+}
+
+// Response returns the response of the corpus to its questions.
+func (c *Corpus) Response() storage.Response {
+	return storage.Response{
+		Answer:     c.Answer,
+		CorpusId:   c.Id,
+		Class:      c.Class,
+		Project:    c.Project,
+		Occurrence: 1,
+		Blocks:     c.Blocks(),
+	}
+}
+
+// Blocks returns the rich content of the corpus, which is a JSON array of
+// rich.Block, the bad content is logged and left out.
+func (c *Corpus) Blocks() []rich.Block {
+	blocks, err := rich.Parse(c.Rich)
 	if err != nil {
+		logger.Errorf("corpus %d: %v", c.Id, err)
+		return nil
+	}
+
+	return blocks
+}
+
+// LoadIntentsFromDB loads the corpora of the project with slots, which is a
+// JSON array of logic.Slot, as the intents.
+func (chatbot *ChatBot) LoadIntentsFromDB() ([]logic.Intent, error) {
+	var rows []Corpus
+	query := Corpus{
+		Project:   chatbot.Config.Project,
+		Qtype:     CORPUS_CORPUS.Int(),
+		QuesState: QuesCustom.Int(),
+	}
+	if err := engine.Find(&rows, &query); err != nil {
 		return nil, err
 	}
+
+	var intents []logic.Intent
 	for _, row := range rows {
-		var corpus []string
-		questions := exp.Split(row.Question, -1)
+		if len(row.Slots) == 0 {
+			continue
+		}
 
-		for _, question := range questions {
-			if strings.TrimSpace(question) == "" {
-				continue
-			}
-			if !strings.HasSuffix(question, "?") && !strings.HasSuffix(question, "？") {
-				question = question + "?"
-			}
-			corpus = append(corpus, question, fmt.Sprintf("%s$$$$%s$$$$%v", question, row.Answer, row.Id))
+		var slots []logic.Slot
+		if err := json.Unmarshal([]byte(row.Slots), &slots); err != nil {
+			logger.Errorf("corpus %d: bad slots: %v", row.Id, err)
+			continue
 		}
-		corpuses = append(corpuses, corpus)
+
+		intents = append(intents, logic.Intent{
+			Id:        row.Id,
+			Class:     row.Class,
+			Project:   row.Project,
+			Questions: SplitQuestions(row.Question),
+			Slots:     slots,
+			Answer:    row.Answer,
+			Blocks:    row.Blocks(),
+		})
 	}
-	results[chatbot.Config.Project] = corpuses
-	return results, nil
 
+	return intents, nil
+}
+
+// RefreshIntents reloads the intents from the database, if the chatbot has
+// an intent set.
+func (chatbot *ChatBot) RefreshIntents() error {
+	if chatbot.Intents == nil {
+		return nil
+	}
+
+	intents, err := chatbot.LoadIntentsFromDB()
+	if err != nil {
+		return err
+	}
+
+	return chatbot.Intents.Set(intents)
+}
+
+// SplitQuestions splits the alternative questions of a corpus, each of them
+// ends with a question mark as they are stored.
+func SplitQuestions(text string) []string {
+	var questions []string
+	for _, question := range questionSeparator.Split(text, -1) {
+		if strings.TrimSpace(question) == "" {
+			continue
+		}
+		if !strings.HasSuffix(question, "?") && !strings.HasSuffix(question, "？") {
+			question = question + "?"
+		}
+		questions = append(questions, question)
+	}
+
+	return questions
 }
 
 func (chatbot *ChatBot) LoadCorpusFromFiles(filePaths []string) (map[string][][]string, error) {
@@ -505,6 +681,8 @@ func (chatbot *ChatBot) SaveCorpusToDB(corpuses map[string][][]string) {
 
 }
 
+// AddFeedbackToDB logs the feedback, with the project and the class of its
+// corpus if answered.
 func (chatbot *ChatBot) AddFeedbackToDB(feedback *Feedback) error {
 	corpus := Corpus{
 		Id: feedback.Cid,
@@ -513,6 +691,11 @@ func (chatbot *ChatBot) AddFeedbackToDB(feedback *Feedback) error {
 		ok  bool
 		err error
 	)
+	// a corpus without id would get any corpus
+	if feedback.Cid <= 0 {
+		_, err = engine.Insert(feedback)
+		return err
+	}
 	if ok, _ = engine.Get(&corpus); ok {
 		feedback.Project = corpus.Project
 		feedback.Class = corpus.Class
@@ -579,6 +762,10 @@ func (q QuesState) Int() int {
 }
 
 func (chatbot *ChatBot) AddCorpusToDB(corpus *Corpus) error {
+	if _, err := rich.Parse(corpus.Rich); err != nil {
+		return err
+	}
+
 	q := Corpus{
 		Question: corpus.Question,
 		Class:    corpus.Class,
@@ -636,7 +823,9 @@ func (chatbot *ChatBot) RemoveCorpusFromDB(corpus *Corpus) error {
 		q.Question = corpus.Question
 	}
 	if ok, err := engine.Get(&q); ok {
-		chatbot.StorageAdapter.Remove(q.Question)
+		for _, question := range SplitQuestions(q.Question) {
+			chatbot.StorageAdapter.Remove(question)
+		}
 		engine.Delete(&q)
 		return err
 	}
@@ -661,12 +850,24 @@ func (chatbot *ChatBot) TrainWithDB() error {
 		}()
 	}
 
-	corpuses, err := chatbot.LoadCorpusFromDB()
+	responses, err := chatbot.LoadResponsesFromDB()
 	if err != nil {
 		return err
 	}
 
-	if err := chatbot.Trainer.TrainWithCorpus(corpuses); err != nil {
+	if err := chatbot.RefreshIntents(); err != nil {
+		return err
+	}
+
+	if err := chatbot.RefreshSynonyms(); err != nil {
+		return err
+	}
+
+	if err := chatbot.RefreshFeedback(); err != nil {
+		return err
+	}
+
+	if err := chatbot.Trainer.TrainWithResponses(responses); err != nil {
 		return err
 	} else {
 		return nil
@@ -702,9 +903,94 @@ func (chatbot *ChatBot) FindCorporaFiles(dir string) []string {
 	return append(files, yamlFiles...)
 }
 
+// GetResponse returns the answers with at least the minimum confidence.
 func (chatbot *ChatBot) GetResponse(text string) []logic.Answer {
-	if chatbot.LogicAdapter.CanProcess(text) {
-		return chatbot.LogicAdapter.Process(text)
+	return chatbot.Respond(text).Answers
+}
+
+// Respond answers the question with the answers of at least
+// Config.MinConfidence, or if there are none, suggests the answers of at least
+// Config.SuggestConfidence, if it's set.
+func (chatbot *ChatBot) Respond(text string) Response {
+	return chatbot.RespondWithHistory(text, nil, nil)
+}
+
+// RespondWithHistory is Respond in the context of the conversation, history
+// is the previous sentences, the earliest first. The answers are rendered as
+// templates with the request parameters, the answers failed to render are
+// kept as is.
+func (chatbot *ChatBot) RespondWithHistory(text string, history []string, params map[string]string) Response {
+	return chatbot.respond(text, history, nil, params, nil)
+}
+
+// RespondWithTrace is RespondWithHistory with the Trace of the response, which
+// explains how the answers are found and why they are chosen.
+func (chatbot *ChatBot) RespondWithTrace(text string, history []string, params map[string]string) Response {
+	return chatbot.respond(text, history, nil, params, new(logic.Trace))
+}
+
+// respond answers the text, as the slot value of the pending intent if it
+// gives any, otherwise by the logic adapter.
+func (chatbot *ChatBot) respond(text string, history []string, pending *logic.Pending,
+	params map[string]string, trace *logic.Trace) Response {
+	response := Response{
+		Trace: trace,
 	}
-	return nil
+	answers := chatbot.Intents.Continue(pending, text, trace)
+	if len(answers) == 0 {
+		if !chatbot.LogicAdapter.CanProcess(text) {
+			trace.Explain("no adapter can process the question")
+			return response
+		}
+		answers = logic.ProcessWithTrace(chatbot.LogicAdapter, text, history, trace)
+	}
+
+	for _, answer := range answers {
+		if err := answer.Render(text, params); err != nil {
+			logger.Errorf("corpus %d: %v", answer.CorpusId, err)
+		}
+
+		if answer.Confidence >= chatbot.Config.MinConfidence {
+			response.Answers = append(response.Answers, answer)
+		} else if chatbot.Config.SuggestConfidence > 0 && answer.Confidence >= chatbot.Config.SuggestConfidence {
+			response.Suggestions = append(response.Suggestions, answer)
+		}
+	}
+	if len(response.Answers) > 0 {
+		response.Suggestions = nil
+	}
+	chatbot.explain(response)
+
+	if adapter, ok := chatbot.StorageAdapter.(storage.CorrectionAdapter); ok {
+		if corrected, corrections := adapter.Correct(text); len(corrections) > 0 {
+			response.DidYouMean = corrected
+			response.Corrections = corrections
+		}
+	}
+
+	return response
+}
+
+// explain explains why the answers of the response are chosen into its trace.
+func (chatbot *ChatBot) explain(response Response) {
+	conf := chatbot.Config
+	switch {
+	case len(response.Answers) > 0:
+		response.Trace.Explain("answered by %s with a confidence of %.3f, at least the minimum %.3f",
+			response.Answers[0].Adapter, response.Answers[0].Confidence, conf.MinConfidence)
+	case len(response.Suggestions) > 0:
+		response.Trace.Explain("suggested by %s with a confidence of %.3f, below the minimum %.3f "+
+			"but at least %.3f to suggest", response.Suggestions[0].Adapter, response.Suggestions[0].Confidence,
+			conf.MinConfidence, conf.SuggestConfidence)
+	default:
+		response.Trace.Explain("no answer with a confidence of at least %.3f", conf.fallbackConfidence())
+	}
+}
+
+func (conf Config) fallbackConfidence() float32 {
+	if conf.SuggestConfidence > 0 && conf.SuggestConfidence < conf.MinConfidence {
+		return conf.SuggestConfidence
+	}
+
+	return conf.MinConfidence
 }
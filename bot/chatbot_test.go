@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+)
+
+type stubMatch []logic.Answer
+
+func (match stubMatch) CanProcess(string) bool {
+	return true
+}
+
+func (match stubMatch) Process(string) []logic.Answer {
+	return append([]logic.Answer(nil), match...)
+}
+
+func (match stubMatch) SetVerbose() {
+}
+
+func TestRespondThresholds(t *testing.T) {
+	tests := []struct {
+		name        string
+		conf        Config
+		confidences []float32
+		answers     []float32
+		suggestions []float32
+	}{
+		{
+			name:        "confident answers only",
+			conf:        Config{MinConfidence: 0.6, SuggestConfidence: 0.3},
+			confidences: []float32{0.8, 0.6, 0.4},
+			answers:     []float32{0.8, 0.6},
+		},
+		{
+			name:        "suggestions without confident answers",
+			conf:        Config{MinConfidence: 0.6, SuggestConfidence: 0.3},
+			confidences: []float32{0.5, 0.3, 0.1},
+			suggestions: []float32{0.5, 0.3},
+		},
+		{
+			name:        "no suggestions unless enabled",
+			conf:        Config{MinConfidence: 0.6},
+			confidences: []float32{0.5},
+		},
+		{
+			name:        "nothing above the thresholds",
+			conf:        Config{MinConfidence: 0.6, SuggestConfidence: 0.3},
+			confidences: []float32{0.2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var match stubMatch
+			for _, confidence := range test.confidences {
+				match = append(match, logic.Answer{Content: "answer", Confidence: confidence})
+			}
+			chatbot := &ChatBot{
+				LogicAdapter: match,
+				Config:       test.conf,
+			}
+
+			response := chatbot.Respond("question")
+			assertConfidences(t, "answers", response.Answers, test.answers)
+			assertConfidences(t, "suggestions", response.Suggestions, test.suggestions)
+		})
+	}
+}
+
+func assertConfidences(t *testing.T, name string, answers []logic.Answer, expect []float32) {
+	if len(answers) != len(expect) {
+		t.Fatalf("expected %d %s, got %v", len(expect), name, answers)
+	}
+	for i := range answers {
+		if answers[i].Confidence != expect[i] {
+			t.Fatalf("expected %s of %v, got %v", name, expect, answers)
+		}
+	}
+}
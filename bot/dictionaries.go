@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+	"github.com/kevwan/chatbot/bot/nlp"
+)
+
+// The kinds of the dictionaries to upload.
+const (
+	DictUser      = "user_dict"
+	DictIdf       = "idf"
+	DictStopWords = "stop_words"
+
+	dictExt           = ".txt"
+	maxDictionarySize = 64 << 20
+)
+
+// Dictionaries returns the dictionaries of the project. The uploaded user
+// dictionary is merged after the configured ones, and the uploaded IDF and
+// stop words take precedence over the configured files.
+func (conf Config) Dictionaries() storage.Dictionaries {
+	dicts := storage.Dictionaries{
+		Dict:      conf.DictFile,
+		UserDicts: append([]string(nil), conf.UserDictFiles...),
+		Idf:       conf.IdfFile,
+		StopWords: conf.StopWordsFile,
+		Pinyin:    conf.PinyinFile,
+	}
+
+	if file := conf.uploadedDictionary(DictUser); len(file) > 0 {
+		dicts.UserDicts = append(dicts.UserDicts, file)
+	}
+	if file := conf.uploadedDictionary(DictIdf); len(file) > 0 {
+		dicts.Idf = file
+	}
+	if file := conf.uploadedDictionary(DictStopWords); len(file) > 0 {
+		dicts.StopWords = file
+	}
+
+	return dicts
+}
+
+// SaveDictionary replaces the uploaded dictionary of the kind, then the
+// storage segments the questions, and the closest match ranks them by BM25,
+// with the new dictionaries. The previous dictionary is restored if the new
+// one fails to load.
+func (chatbot *ChatBot) SaveDictionary(kind string, reader io.Reader) error {
+	switch kind {
+	case DictUser, DictIdf, DictStopWords:
+	default:
+		return fmt.Errorf("unknown dictionary: %s", kind)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(reader, maxDictionarySize+1))
+	if err != nil {
+		return err
+	}
+	if len(content) > maxDictionarySize {
+		return fmt.Errorf("dictionary is larger than %d bytes", maxDictionarySize)
+	}
+	if err := storage.ValidateDictionary(string(content)); err != nil {
+		return err
+	}
+
+	chatbot.dictLock.Lock()
+	defer chatbot.dictLock.Unlock()
+
+	file := chatbot.Config.dictionaryPath(kind)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	previous, readErr := ioutil.ReadFile(file)
+	if err := writeFileAtomically(file, content); err != nil {
+		return err
+	}
+
+	if err := chatbot.applyDictionaries(); err != nil {
+		if readErr == nil {
+			writeFileAtomically(file, previous)
+		} else {
+			os.Remove(file)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// applyDictionaries switches the storage, and the terms of the logic adapter
+// if ranking by BM25, to the dictionaries of the project.
+func (chatbot *ChatBot) applyDictionaries() error {
+	adapter, ok := chatbot.StorageAdapter.(storage.DictionaryAdapter)
+	if !ok {
+		return errors.New("the storage doesn't support changing dictionaries")
+	}
+
+	dicts := chatbot.Config.Dictionaries()
+	var terms *nlp.Terms
+	if ranking, err := logic.ParseRanking(chatbot.Config.Ranking); err == nil && ranking != logic.RankBySimilarity {
+		if terms, err = loadTerms(dicts); err != nil {
+			return err
+		}
+	}
+
+	if err := adapter.SetDictionaries(dicts); err != nil {
+		return err
+	}
+	if terms != nil {
+		logic.SetTerms(chatbot.LogicAdapter, terms)
+	}
+
+	return nil
+}
+
+// dictionaryPath returns the file of the uploaded dictionary of the kind,
+// which is kept in conf.DictDir, dicts/<project> by default.
+func (conf Config) dictionaryPath(kind string) string {
+	dir := conf.DictDir
+	if len(dir) == 0 {
+		dir = filepath.Join("dicts", conf.Project)
+	}
+
+	return filepath.Join(dir, kind+dictExt)
+}
+
+func (conf Config) uploadedDictionary(kind string) string {
+	file := conf.dictionaryPath(kind)
+	if _, err := os.Stat(file); err != nil {
+		return ""
+	}
+
+	return file
+}
+
+func fileOrDefault(file, defaultFile string) string {
+	if len(file) > 0 {
+		return file
+	}
+
+	return defaultFile
+}
+
+func writeFileAtomically(file string, content []byte) error {
+	temp := file + ".tmp"
+	if err := ioutil.WriteFile(temp, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(temp, file)
+}
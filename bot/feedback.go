@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+)
+
+// defaultMinAccepts is the least times a question of the users is accepted
+// with the answer of a corpus to be answered by the corpus directly.
+const defaultMinAccepts = 3
+
+// feedbackTally is the feedback on the answers of a corpus to a question.
+type feedbackTally struct {
+	Question string `xorm:"question"`
+	Cid      int    `xorm:"cid"`
+	Accepts  int    `xorm:"accepts"`
+	Rejects  int    `xorm:"rejects"`
+}
+
+// NewFeedbackSet returns an empty feedback set weighted by the config, which
+// is kept up to date by RefreshFeedback.
+func NewFeedbackSet(conf Config) *logic.FeedbackSet {
+	return logic.NewFeedbackSet(conf.feedbackWeight())
+}
+
+// LoadFeedbackFromDB loads the accepted and rejected times of the corpora of
+// the project, and the questions of the users accepted with the answers of a
+// corpus at least min_accepts times and more than rejected, with the first
+// question of the corpus.
+func (chatbot *ChatBot) LoadFeedbackFromDB() (map[int]logic.FeedbackCounts, map[string]string, error) {
+	var corpora []Corpus
+	if err := engine.Cols("id", "accept_count", "reject_count").
+		Where("project = ? and (accept_count > 0 or reject_count > 0)", chatbot.Config.Project).
+		Find(&corpora); err != nil {
+		return nil, nil, err
+	}
+
+	counts := make(map[int]logic.FeedbackCounts, len(corpora))
+	for _, corpus := range corpora {
+		counts[corpus.Id] = logic.FeedbackCounts{
+			Accepts: corpus.AcceptCount,
+			Rejects: corpus.RejectCount,
+		}
+	}
+
+	var tallies []feedbackTally
+	if err := engine.Table(&Feedback{}).
+		Select("question, cid, sum(accept_count) as accepts, sum(reject_count) as rejects").
+		Where("project = ? and cid > 0", chatbot.Config.Project).
+		GroupBy("question, cid").Find(&tallies); err != nil {
+		return nil, nil, err
+	}
+
+	// the corpus most accepted with each question
+	best := make(map[string]feedbackTally)
+	for _, tally := range tallies {
+		if tally.Accepts < chatbot.Config.minAccepts() || tally.Accepts <= tally.Rejects {
+			continue
+		}
+		if current, ok := best[tally.Question]; !ok || tally.Accepts > current.Accepts {
+			best[tally.Question] = tally
+		}
+	}
+	if len(best) == 0 {
+		return counts, nil, nil
+	}
+
+	ids := make([]int, 0, len(best))
+	for _, tally := range best {
+		ids = append(ids, tally.Cid)
+	}
+	var rows []Corpus
+	if err := engine.In("id", ids).Find(&rows); err != nil {
+		return nil, nil, err
+	}
+	questions := make(map[int]string, len(rows))
+	for _, row := range rows {
+		if stored := SplitQuestions(row.Question); len(stored) > 0 && len(row.Slots) == 0 {
+			questions[row.Id] = stored[0]
+		}
+	}
+
+	associations := make(map[string]string, len(best))
+	for question, tally := range best {
+		if stored, ok := questions[tally.Cid]; ok {
+			associations[question] = stored
+		}
+	}
+
+	return counts, associations, nil
+}
+
+// RefreshFeedback reloads the feedback from the database, if the chatbot has
+// a feedback set.
+func (chatbot *ChatBot) RefreshFeedback() error {
+	if chatbot.Feedback == nil {
+		return nil
+	}
+
+	counts, associations, err := chatbot.LoadFeedbackFromDB()
+	if err != nil {
+		return err
+	}
+
+	chatbot.Feedback.Set(counts, associations)
+	return nil
+}
+
+// UpdateFeedbackCounter counts the answer of the corpus to the question as
+// accepted or rejected, on the latest feedback of them, or a new one if the
+// answer wasn't logged.
+func (f *ChatBotFactory) UpdateFeedbackCounter(id int, question string, isOk bool) error {
+	question = strings.TrimSpace(question)
+	if id <= 0 || len(question) == 0 {
+		return fmt.Errorf("feedback of corpus %d to question '%s' is invalid", id, question)
+	}
+
+	var feedback Feedback
+	ok, err := engine.Where("cid = ? and question = ?", id, question).Desc("id").Get(&feedback)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		corpus := Corpus{
+			Id: id,
+		}
+		if ok, err = engine.Get(&corpus); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("record not found")
+		}
+
+		feedback = Feedback{
+			Cid:      id,
+			Class:    corpus.Class,
+			Project:  corpus.Project,
+			Question: question,
+			Answer:   corpus.Answer,
+		}
+		if _, err = engine.Insert(&feedback); err != nil {
+			return err
+		}
+	}
+
+	if isOk {
+		feedback.AcceptCount++
+	} else {
+		feedback.RejectCount++
+	}
+	_, err = engine.Id(feedback.Id).Cols("reject_count", "accept_count").Update(&feedback)
+	return err
+}
+
+func (conf Config) feedbackWeight() float32 {
+	switch {
+	case conf.FeedbackWeight < 0:
+		return 0
+	case conf.FeedbackWeight == 0:
+		return logic.DefaultFeedbackWeight
+	default:
+		return conf.FeedbackWeight
+	}
+}
+
+func (conf Config) minAccepts() int {
+	if conf.MinAccepts > 0 {
+		return conf.MinAccepts
+	}
+
+	return defaultMinAccepts
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+	"github.com/kevwan/chatbot/bot/nlp"
+)
+
+const (
+	LogicExact    = "exact"
+	LogicIntent   = "intent"
+	LogicRules    = "rules"
+	LogicClosest  = "closest"
+	LogicSemantic = "semantic"
+	LogicDefault  = "default"
+
+	embeddingDimension = 256
+	minNgram           = 1
+	maxNgram           = 3
+	vectorIndexExt     = ".ann"
+)
+
+// NewLogicAdapter creates the logic adapter of the project on the given
+// storage. conf.Logic is a comma separated list of the adapters, like
+// exact,intent,rules,closest,semantic,default, combined by conf.ComboStrategy, by
+// default falling back to the next adapter if an adapter gives no answer above
+// the suggestion or minimum confidence. closest is used if conf.Logic is
+// empty. conf.Ranking selects how the closest match ranks the candidates, and
+// the vector index of the semantic match is saved alongside the store file.
+// The intent match has no intents, use NewLogicAdapterWithIntents instead.
+func NewLogicAdapter(conf Config, store storage.StorageAdapter, tops int) (logic.LogicAdapter, error) {
+	return NewLogicAdapterWithIntents(conf, store, logic.NewIntentSet(), tops)
+}
+
+// NewLogicAdapterWithIntents is NewLogicAdapter with the intents of the intent
+// match, which are kept up to date by the caller.
+func NewLogicAdapterWithIntents(conf Config, store storage.StorageAdapter, intents *logic.IntentSet,
+	tops int) (logic.LogicAdapter, error) {
+	names := strings.Split(conf.Logic, ",")
+	matches := make([]logic.LogicAdapter, 0, len(names))
+	for _, name := range names {
+		match, err := newMatch(strings.TrimSpace(name), conf, store, intents, tops)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+
+	strategy, err := logic.ParseComboStrategy(conf.ComboStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	return logic.NewStrategyComboMatch(logic.ComboConfig{
+		Strategy:      strategy,
+		MinConfidence: conf.fallbackConfidence(),
+		Weights:       conf.ComboWeights,
+		Tops:          tops,
+	}, matches...)
+}
+
+func newMatch(name string, conf Config, store storage.StorageAdapter, intents *logic.IntentSet,
+	tops int) (logic.LogicAdapter, error) {
+	switch name {
+	case LogicExact:
+		return logic.NewExactMatch(store, tops), nil
+	case LogicIntent:
+		return logic.NewIntentMatch(intents), nil
+	case LogicRules:
+		return logic.NewRulesMatch(conf.Rules)
+	case "", LogicClosest:
+		return newClosestMatch(conf, store, tops)
+	case LogicSemantic:
+		embedder := nlp.NewNgramEmbedder(embeddingDimension, minNgram, maxNgram)
+		return logic.NewSemanticMatch(store, embedder, conf.storePath()+vectorIndexExt, tops)
+	case LogicDefault:
+		if len(conf.DefaultReply) == 0 {
+			return nil, errors.New("default logic adapter requires default_reply")
+		}
+		return logic.NewDefaultMatch(conf.DefaultReply), nil
+	default:
+		return nil, fmt.Errorf("unknown logic adapter: %s", name)
+	}
+}
+
+func newClosestMatch(conf Config, store storage.StorageAdapter, tops int) (logic.LogicAdapter, error) {
+	ranking, err := logic.ParseRanking(conf.Ranking)
+	if err != nil {
+		return nil, err
+	}
+
+	if ranking == logic.RankBySimilarity {
+		return logic.NewClosestMatch(store, tops), nil
+	}
+
+	terms, err := loadTerms(conf.Dictionaries())
+	if err != nil {
+		return nil, err
+	}
+
+	return logic.NewRankedClosestMatch(store, tops, ranking, terms)
+}
+
+// loadTerms loads the terms to rank by BM25 from the dictionaries.
+func loadTerms(dicts storage.Dictionaries) (*nlp.Terms, error) {
+	return nlp.LoadTerms(fileOrDefault(dicts.Dict, nlp.DictFile), fileOrDefault(dicts.Idf, nlp.IdfFile),
+		fileOrDefault(dicts.StopWords, nlp.StopWordsFile), dicts.UserDicts...)
+}
@@ -0,0 +1,43 @@
+package nlp
+
+// DefaultBM25 is the BM25 with the commonly used parameters.
+var DefaultBM25 = BM25{
+	K1: 1.2,
+	B:  0.75,
+}
+
+// BM25 scores documents against queries by the Okapi BM25 ranking function,
+// K1 controls the term frequency saturation and B the length normalization.
+type BM25 struct {
+	K1 float64
+	B  float64
+}
+
+// Score returns the BM25 score of the document terms for the query terms,
+// avgLength is the average number of terms of the documents being ranked.
+func (bm BM25) Score(query, document []string, avgLength float64, idf func(string) float64) float64 {
+	if len(document) == 0 || avgLength <= 0 {
+		return 0
+	}
+
+	frequencies := make(map[string]int, len(document))
+	for _, term := range document {
+		frequencies[term]++
+	}
+
+	var score float64
+	norm := bm.K1 * (1 - bm.B + bm.B*float64(len(document))/avgLength)
+	seen := make(map[string]bool, len(query))
+	for _, term := range query {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		if tf, ok := frequencies[term]; ok {
+			score += idf(term) * float64(tf) * (bm.K1 + 1) / (float64(tf) + norm)
+		}
+	}
+
+	return score
+}
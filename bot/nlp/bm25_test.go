@@ -0,0 +1,64 @@
+package nlp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBM25Score(t *testing.T) {
+	idf := func(term string) float64 {
+		return map[string]float64{"a": 2, "b": 1, "c": 0.5}[term]
+	}
+
+	tests := []struct {
+		name      string
+		query     []string
+		document  []string
+		avgLength float64
+		expect    float64
+	}{
+		{
+			name:      "term frequency saturates",
+			query:     []string{"a", "b"},
+			document:  []string{"a", "a", "c"},
+			avgLength: 3,
+			// 2 * 2 * 2.2 / (2 + 1.2)
+			expect: 2.75,
+		},
+		{
+			name:      "long document normalized",
+			query:     []string{"a"},
+			document:  []string{"a", "c", "c", "c", "c", "c"},
+			avgLength: 3,
+			// 2 * 1 * 2.2 / (1 + 1.2 * (0.25 + 0.75 * 2))
+			expect: 4.4 / 3.1,
+		},
+		{
+			name:      "duplicate query terms counted once",
+			query:     []string{"a", "a", "b"},
+			document:  []string{"a", "b"},
+			avgLength: 2,
+			expect:    3,
+		},
+		{
+			name:      "no matched terms",
+			query:     []string{"b"},
+			document:  []string{"a", "c"},
+			avgLength: 2,
+		},
+		{
+			name:      "empty document",
+			query:     []string{"a"},
+			avgLength: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			score := DefaultBM25.Score(test.query, test.document, test.avgLength, idf)
+			if math.Abs(score-test.expect) > 1e-9 {
+				t.Fatalf("expected %v, got %v", test.expect, score)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package nlp
+
+// Cluster groups the texts by similarity. Each text joins the cluster of the
+// most similar leader, the first text of a cluster, if the similarity is at
+// least threshold, otherwise it leads a new cluster. The earlier texts lead,
+// so the texts are better sorted by importance. It returns the indexes of the
+// texts of each cluster, in the order of the leaders.
+func Cluster(texts []string, threshold float32) [][]int {
+	var clusters [][]int
+	var leaders []string
+	for i, text := range texts {
+		matcher := NewSimilarityMatcher(text)
+		best := -1
+		// the similarities above min, just below threshold, are at least threshold
+		min := threshold - 1e-6
+		for j, leader := range leaders {
+			if similarity, ok := matcher.SimilarityAbove(leader, min); ok {
+				best = j
+				min = similarity
+			}
+		}
+
+		if best < 0 {
+			clusters = append(clusters, []int{i})
+			leaders = append(leaders, text)
+		} else {
+			clusters[best] = append(clusters[best], i)
+		}
+	}
+
+	return clusters
+}
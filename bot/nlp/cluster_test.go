@@ -0,0 +1,28 @@
+package nlp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCluster(t *testing.T) {
+	texts := []string{
+		"怎么重置密码",
+		"如何申请服务器",
+		"怎么重置密码呢",
+		"重置密码",
+		"how to reset the password",
+		"如何申请一台服务器",
+	}
+
+	expect := [][]int{{0, 2, 3}, {1, 5}, {4}}
+	if clusters := Cluster(texts, 0.6); !reflect.DeepEqual(clusters, expect) {
+		t.Fatalf("expected %v, got %v", expect, clusters)
+	}
+	if clusters := Cluster(texts, 1); len(clusters) != len(texts) {
+		t.Fatalf("expected each text a cluster, got %v", clusters)
+	}
+	if clusters := Cluster(nil, 0.6); len(clusters) != 0 {
+		t.Fatalf("expected no clusters, got %v", clusters)
+	}
+}
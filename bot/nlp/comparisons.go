@@ -1,5 +1,7 @@
 package nlp
 
+import "math"
+
 const (
 	Ins = iota
 	Del
@@ -42,15 +44,56 @@ func (operation EditOperation) String() string {
 	return "del"
 }
 
+// SimilarityForStrings returns the similarity of source and target in [0, 1],
+// by the edit distance with DefaultOptions relative to their total length.
 func SimilarityForStrings(source, target string) float32 {
-	distance := DistanceForStrings([]rune(source), []rune(target), DefaultOptions)
-	total := len([]rune(source)) + len([]rune(target))
-	return float32(total-distance) / float32(total)
+	return NewSimilarityMatcher(source).Similarity(target)
 }
 
 // DistanceForStrings returns the edit distance between source and target.
 func DistanceForStrings(source []rune, target []rune, op Options) int {
-	return DistanceForMatrix(MatrixForStrings(source, target, op))
+	distance, _ := BoundedDistance(source, target, op, math.MaxInt32)
+	return distance
+}
+
+// BoundedDistance returns the edit distance between source and target if it is
+// no more than maxDistance, it keeps two rows of the Levenshtein matrix only,
+// and stops as soon as all the cells of a row are over maxDistance.
+func BoundedDistance(source []rune, target []rune, op Options, maxDistance int) (int, bool) {
+	// the length difference takes insertions or deletions at least
+	if len(source) > len(target) && (len(source)-len(target))*op.DelCost > maxDistance ||
+		len(target) > len(source) && (len(target)-len(source))*op.InsCost > maxDistance {
+		return 0, false
+	}
+
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j * op.InsCost
+	}
+
+	for i := 1; i <= len(source); i++ {
+		current[0] = i * op.DelCost
+		best := current[0]
+		for j := 1; j <= len(target); j++ {
+			delCost := previous[j] + op.DelCost
+			matchSubCost := previous[j-1]
+			if !op.Matches(source[i-1], target[j-1]) {
+				matchSubCost += op.SubCost
+			}
+			insCost := current[j-1] + op.InsCost
+			current[j] = min(delCost, min(matchSubCost, insCost))
+			best = min(best, current[j])
+		}
+		// the costs are never negative, the rows below can't do better
+		if best > maxDistance {
+			return 0, false
+		}
+		previous, current = current, previous
+	}
+
+	distance := previous[len(target)]
+	return distance, distance <= maxDistance
 }
 
 // DistanceForMatrix reads the edit distance off the given Levenshtein matrix.
@@ -100,6 +143,50 @@ func MatrixForStrings(source []rune, target []rune, op Options) [][]int {
 	return matrix
 }
 
+// TypoDistance returns the number of the typos between source and target if
+// it is no more than maxDistance, the typos are the insertions, deletions and
+// substitutions of runes, and the swaps of adjacent runes, by the optimal
+// string alignment distance.
+func TypoDistance(source []rune, target []rune, maxDistance int) (int, bool) {
+	if len(source)-len(target) > maxDistance || len(target)-len(source) > maxDistance {
+		return 0, false
+	}
+
+	// the rows of source[:i-1], source[:i] and source[:i+1]
+	beforePrevious := make([]int, len(target)+1)
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	previousBest := 0
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		best := current[0]
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, min(current[j-1]+1, previous[j-1]+cost))
+			if i > 1 && j > 1 && source[i-1] == target[j-2] && source[i-2] == target[j-1] {
+				current[j] = min(current[j], beforePrevious[j-2]+1)
+			}
+			best = min(best, current[j])
+		}
+		// a swap reaches back two rows, which both have to be over
+		if best > maxDistance && previousBest > maxDistance {
+			return 0, false
+		}
+		previousBest = best
+		beforePrevious, previous, current = previous, current, beforePrevious
+	}
+
+	distance := previous[len(target)]
+	return distance, distance <= maxDistance
+}
+
 func min(a int, b int) int {
 	if b < a {
 		return b
@@ -0,0 +1,145 @@
+package nlp
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var benchmarkSimilarity float32
+
+func TestSimilarityMatcher(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	alphabet := []rune("abc登录平台")
+	randomString := func() string {
+		runes := make([]rune, random.Intn(150))
+		for i := range runes {
+			runes[i] = alphabet[random.Intn(len(alphabet))]
+		}
+		return string(runes)
+	}
+
+	for i := 0; i < 500; i++ {
+		source, target := randomString(), randomString()
+		total := len([]rune(source)) + len([]rune(target))
+		if total == 0 {
+			continue
+		}
+
+		distance := DistanceForMatrix(MatrixForStrings([]rune(source), []rune(target), DefaultOptions))
+		expected := float32(total-distance) / float32(total)
+		matcher := NewSimilarityMatcher(source)
+		if similarity := matcher.Similarity(target); similarity != expected {
+			t.Fatalf("Similarity(%s, %s): expected %v, got %v", source, target, expected, similarity)
+		}
+
+		min := random.Float32()
+		if similarity, ok := matcher.SimilarityAbove(target, min); ok != (expected > min) ||
+			ok && similarity != expected {
+			t.Fatalf("SimilarityAbove(%s, %s, %v): expected %v, got %v", source, target, min, expected, similarity)
+		}
+
+		maxDistance := random.Intn(total + 1)
+		if actual, ok := BoundedDistance([]rune(source), []rune(target), DefaultOptions,
+			maxDistance); ok != (distance <= maxDistance) || ok && actual != distance {
+			t.Fatalf("BoundedDistance(%s, %s, %d): expected %d, got %d", source, target, maxDistance,
+				distance, actual)
+		}
+	}
+}
+
+func BenchmarkSimilarity(b *testing.B) {
+	source, targets := benchmarkCandidates(10000)
+
+	b.Run("matrix", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, target := range targets {
+				total := len([]rune(source)) + len([]rune(target))
+				distance := DistanceForMatrix(MatrixForStrings([]rune(source), []rune(target), DefaultOptions))
+				benchmarkSimilarity = float32(total-distance) / float32(total)
+			}
+		}
+	})
+	b.Run("two rows", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, target := range targets {
+				total := len([]rune(source)) + len([]rune(target))
+				distance := DistanceForStrings([]rune(source), []rune(target), DefaultOptions)
+				benchmarkSimilarity = float32(total-distance) / float32(total)
+			}
+		}
+	})
+	b.Run("bit parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			matcher := NewSimilarityMatcher(source)
+			for _, target := range targets {
+				benchmarkSimilarity = matcher.Similarity(target)
+			}
+		}
+	})
+	b.Run("bit parallel top 5", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			matcher := NewSimilarityMatcher(source)
+			tops := make([]float32, 5)
+			for _, target := range targets {
+				lowest := 0
+				for j := range tops {
+					if tops[j] < tops[lowest] {
+						lowest = j
+					}
+				}
+				if similarity, ok := matcher.SimilarityAbove(target, tops[lowest]); ok {
+					tops[lowest] = similarity
+				}
+			}
+		}
+	})
+}
+
+// benchmarkCandidates returns a question and the candidates of it, like the
+// ones found by the storage.
+func benchmarkCandidates(n int) (string, []string) {
+	random := rand.New(rand.NewSource(1))
+	words := []string{"怎么", "登录", "蓝鲸", "平台", "部署", "服务", "为什么", "失败", "重启", "日志",
+		"查看", "配置", "数据库", "权限", "申请"}
+	sentence := func() string {
+		var text string
+		for i := 0; i < 1+random.Intn(30); i++ {
+			text += words[random.Intn(len(words))]
+		}
+		return text
+	}
+
+	targets := make([]string, n)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("%s%d", sentence(), i)
+	}
+
+	return "怎么登录蓝鲸平台查看服务日志", targets
+}
+
+func TestTypoDistance(t *testing.T) {
+	tests := []struct {
+		source   string
+		target   string
+		max      int
+		distance int
+		ok       bool
+	}{
+		{"restart", "restart", 1, 0, true},
+		{"restrat", "restart", 1, 1, true},
+		{"kubernetse", "kubernetes", 1, 1, true},
+		{"servces", "services", 1, 1, true},
+		{"srevcies", "services", 2, 2, true},
+		{"deploy", "restart", 2, 0, false},
+		{"abc", "abcdef", 2, 0, false},
+	}
+
+	for _, test := range tests {
+		distance, ok := TypoDistance([]rune(test.source), []rune(test.target), test.max)
+		if ok != test.ok || ok && distance != test.distance {
+			t.Errorf("TypoDistance(%s, %s): expected %d %t, got %d %t", test.source, test.target,
+				test.distance, test.ok, distance, ok)
+		}
+	}
+}
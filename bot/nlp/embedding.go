@@ -0,0 +1,97 @@
+package nlp
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+type (
+	// Embedder maps sentences to normalized vectors, similar sentences are
+	// mapped to vectors with high cosine similarity.
+	Embedder interface {
+		// Name identifies the embedder with its parameters, vectors of
+		// embedders with different names are not comparable.
+		Name() string
+		Dimension() int
+		Embed(sentence string) []float32
+	}
+
+	// NgramEmbedder embeds sentences by hashing their character n-grams into
+	// a fixed number of dimensions, which runs on CPU without any model.
+	NgramEmbedder struct {
+		dimension int
+		minN      int
+		maxN      int
+	}
+)
+
+// NewNgramEmbedder returns an embedder of the character n-grams from minN
+// to maxN runes, hashed into vectors of the given dimension.
+func NewNgramEmbedder(dimension, minN, maxN int) *NgramEmbedder {
+	return &NgramEmbedder{
+		dimension: dimension,
+		minN:      minN,
+		maxN:      maxN,
+	}
+}
+
+func (embedder *NgramEmbedder) Name() string {
+	return fmt.Sprintf("ngram-%d-%d-%d", embedder.dimension, embedder.minN, embedder.maxN)
+}
+
+func (embedder *NgramEmbedder) Dimension() int {
+	return embedder.dimension
+}
+
+func (embedder *NgramEmbedder) Embed(sentence string) []float32 {
+	vector := make([]float32, embedder.dimension)
+	runes := []rune(strings.Map(func(r rune) rune {
+		if isWordRune(r) {
+			return r
+		}
+		return -1
+	}, strings.ToLower(sentence)))
+
+	for n := embedder.minN; n <= embedder.maxN; n++ {
+		for i := 0; i+n <= len(runes); i++ {
+			hash := fnv.New32a()
+			hash.Write([]byte(string(runes[i : i+n])))
+			sum := hash.Sum32()
+			// the sign bit halves the collisions' bias, longer n-grams weigh more
+			weight := float32(n)
+			if sum&1 == 1 {
+				weight = -weight
+			}
+			vector[(sum>>1)%uint32(embedder.dimension)] += weight
+		}
+	}
+
+	return normalize(vector)
+}
+
+// CosineSimilarity returns the cosine similarity of two normalized vectors.
+func CosineSimilarity(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
+
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, value := range vector {
+		sum += float64(value) * float64(value)
+	}
+	if sum == 0 {
+		return vector
+	}
+
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
@@ -0,0 +1,39 @@
+package nlp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNgramEmbedder(t *testing.T) {
+	embedder := NewNgramEmbedder(256, 1, 3)
+	if embedder.Name() != "ngram-256-1-3" || embedder.Dimension() != 256 {
+		t.Fatalf("unexpected embedder %s of dimension %d", embedder.Name(), embedder.Dimension())
+	}
+
+	vector := embedder.Embed("How to restart the service?")
+	var sum float64
+	for _, value := range vector {
+		sum += float64(value) * float64(value)
+	}
+	if len(vector) != 256 || math.Abs(sum-1) > 1e-5 {
+		t.Fatalf("expected a normalized vector of 256, got %d of norm %v", len(vector), sum)
+	}
+
+	// the case and the punctuations are ignored
+	if similarity := CosineSimilarity(vector, embedder.Embed("how to restart the service")); similarity < 0.9999 {
+		t.Fatalf("expected the same vector, got similarity %v", similarity)
+	}
+
+	similar := CosineSimilarity(vector, embedder.Embed("how to restart services"))
+	unrelated := CosineSimilarity(vector, embedder.Embed("where are the logs kept"))
+	if similar <= unrelated {
+		t.Fatalf("expected the similar sentence closer, got %v and %v", similar, unrelated)
+	}
+
+	for _, value := range embedder.Embed("?!") {
+		if value != 0 {
+			t.Fatal("expected a zero vector without words")
+		}
+	}
+}
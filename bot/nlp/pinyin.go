@@ -0,0 +1,156 @@
+package nlp
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxPinyins is the most combinations of the readings of a word to return.
+const maxPinyins = 16
+
+var toneMarks = strings.NewReplacer(
+	"ā", "a", "á", "a", "ǎ", "a", "à", "a",
+	"ē", "e", "é", "e", "ě", "e", "è", "e", "ê", "e",
+	"ī", "i", "í", "i", "ǐ", "i", "ì", "i",
+	"ō", "o", "ó", "o", "ǒ", "o", "ò", "o",
+	"ū", "u", "ú", "u", "ǔ", "u", "ù", "u",
+	"ǖ", "v", "ǘ", "v", "ǚ", "v", "ǜ", "v", "ü", "v",
+	"ń", "n", "ň", "n", "ǹ", "n", "ḿ", "m",
+)
+
+var (
+	defaultPinyin     PinyinTable
+	defaultPinyinOnce sync.Once
+)
+
+// PinyinTable maps the Han characters to their readings in pinyin, without
+// the tones.
+type PinyinTable map[rune][]string
+
+// LoadPinyin loads the pinyin table from the file, which has a character and
+// its readings separated by spaces or commas on each line, like "行 xing hang",
+// or is in the format of pinyin-data, like "U+884C: xíng,háng  # 行". The tones
+// are dropped, either marked or numbered.
+func LoadPinyin(file string) (PinyinTable, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table := make(PinyinTable)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.IndexByte(line, '#'); index >= 0 {
+			line = line[:index]
+		}
+
+		var char rune
+		var readings string
+		if strings.HasPrefix(line, "U+") {
+			index := strings.IndexByte(line, ':')
+			if index < 0 {
+				continue
+			}
+			code, err := strconv.ParseUint(line[2:index], 16, 32)
+			if err != nil {
+				continue
+			}
+			char = rune(code)
+			readings = line[index+1:]
+		} else {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			chars := []rune(fields[0])
+			if len(chars) != 1 {
+				continue
+			}
+			char = chars[0]
+			readings = strings.Join(fields[1:], " ")
+		}
+
+		for _, reading := range strings.FieldsFunc(readings, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		}) {
+			table.add(char, reading)
+		}
+	}
+
+	return table, scanner.Err()
+}
+
+// DefaultPinyin returns the built-in pinyin table, the most common reading of
+// each character of GB2312. The table is shared, and must not be modified.
+func DefaultPinyin() PinyinTable {
+	defaultPinyinOnce.Do(func() {
+		defaultPinyin = make(PinyinTable)
+		for _, line := range strings.Split(defaultPinyinData, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			for _, char := range fields[1] {
+				defaultPinyin.add(char, fields[0])
+			}
+		}
+	})
+
+	return defaultPinyin
+}
+
+// Pinyins returns the readings of the word, the readings of its characters
+// separated by spaces, nil if any character has no reading.
+func (table PinyinTable) Pinyins(word string) []string {
+	if len(table) == 0 {
+		return nil
+	}
+
+	pinyins := []string{""}
+	for i, char := range []rune(word) {
+		readings, ok := table[char]
+		if !ok {
+			return nil
+		}
+
+		var next []string
+		for _, pinyin := range pinyins {
+			for _, reading := range readings {
+				if i > 0 {
+					next = append(next, pinyin+" "+reading)
+				} else {
+					next = append(next, reading)
+				}
+				if len(next) == maxPinyins {
+					break
+				}
+			}
+			if len(next) == maxPinyins {
+				break
+			}
+		}
+		pinyins = next
+	}
+
+	return pinyins
+}
+
+func (table PinyinTable) add(char rune, reading string) {
+	reading = strings.TrimRightFunc(toneMarks.Replace(strings.ToLower(reading)), unicode.IsDigit)
+	if len(reading) == 0 {
+		return
+	}
+
+	for _, each := range table[char] {
+		if each == reading {
+			return
+		}
+	}
+	table[char] = append(table[char], reading)
+}
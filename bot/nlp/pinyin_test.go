@@ -0,0 +1,43 @@
+package nlp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadPinyin(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pinyin.txt")
+	content := "# pinyin-data\nU+884C: xíng,háng  # 行\n登 deng1\n录 lu4\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := LoadPinyin(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinyins := table.Pinyins("登录"); !reflect.DeepEqual(pinyins, []string{"deng lu"}) {
+		t.Fatalf("expected the tones dropped, got %v", pinyins)
+	}
+	if pinyins := table.Pinyins("行"); !reflect.DeepEqual(pinyins, []string{"xing", "hang"}) {
+		t.Fatalf("expected all the readings, got %v", pinyins)
+	}
+	if pinyins := table.Pinyins("登陆"); pinyins != nil {
+		t.Fatalf("expected no readings of the unknown characters, got %v", pinyins)
+	}
+}
+
+func TestDefaultPinyin(t *testing.T) {
+	table := DefaultPinyin()
+	if pinyins := table.Pinyins("登录"); !reflect.DeepEqual(pinyins, []string{"deng lu"}) {
+		t.Fatalf("expected the built-in readings, got %v", pinyins)
+	}
+	if pinyins := table.Pinyins("绿"); !reflect.DeepEqual(pinyins, []string{"lv"}) {
+		t.Fatalf("expected ü read as v, got %v", pinyins)
+	}
+	if !reflect.DeepEqual(table.Pinyins("登陆"), table.Pinyins("登录")) {
+		t.Fatal("expected the homophones read the same")
+	}
+}
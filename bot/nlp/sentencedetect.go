@@ -18,13 +18,31 @@ var (
 		'吗',
 		'么',
 	})
+
+	englishQuestionWords = createWordSet([]string{
+		"what", "when", "where", "which", "who", "whom", "whose", "why", "how",
+	})
+
+	// the auxiliaries start questions only before their subjects, like "can I",
+	// but not "can opener" or "do it now"
+	englishAuxiliaries = createWordSet([]string{
+		"am", "is", "are", "was", "were", "do", "does", "did", "can", "could", "would",
+		"will", "should", "shall", "may", "might", "must", "have", "has", "had",
+	})
+
+	englishSubjects = createWordSet([]string{
+		"i", "you", "he", "she", "it", "we", "they", "this", "that", "these", "those",
+		"there", "the", "a", "an", "my", "your", "his", "her", "its", "our", "their",
+		"any", "anyone", "anybody", "someone", "somebody",
+	})
 )
 
+// IsQuestion reports whether the sentence is a question, by the question marks
+// and the question words of Chinese, or the leading words of English.
 func IsQuestion(sentence string) bool {
-	// we don't check whether question or not in English
-	//if isAscii(sentence) {
-	//	return false
-	//}
+	if DetectLanguage(sentence) == English && isEnglishQuestion(sentence) {
+		return true
+	}
 
 	chars := []rune(strings.TrimSpace(sentence))
 	if len(chars) == 0 {
@@ -44,6 +62,46 @@ func IsQuestion(sentence string) bool {
 	return false
 }
 
+func isEnglishQuestion(sentence string) bool {
+	words := strings.FieldsFunc(strings.ToLower(sentence), func(r rune) bool {
+		return !isLatin(r) && r != '\''
+	})
+	if len(words) == 0 {
+		return false
+	}
+
+	first := words[0]
+	// the contractions like "what's", "isn't" and "don't"
+	if index := strings.IndexByte(first, '\''); index >= 0 {
+		if _, ok := englishQuestionWords[first[:index]]; ok {
+			return true
+		}
+		first = strings.TrimSuffix(first, "n't")
+		if _, ok := englishAuxiliaries[first]; ok || first == "ca" || first == "wo" {
+			return len(words) > 1 && isEnglishSubject(words[1])
+		}
+		return false
+	}
+
+	if _, ok := englishQuestionWords[first]; ok {
+		return true
+	}
+	if _, ok := englishAuxiliaries[first]; ok {
+		return len(words) > 1 && isEnglishSubject(words[1])
+	}
+
+	return false
+}
+
+func isEnglishSubject(word string) bool {
+	if _, ok := englishSubjects[word]; ok {
+		return true
+	}
+
+	// the possessives like "john's"
+	return strings.HasSuffix(word, "'s")
+}
+
 func createSet(items []rune) map[rune]lang.PlaceholderType {
 	ret := make(map[rune]lang.PlaceholderType)
 	for _, item := range items {
@@ -52,6 +110,14 @@ func createSet(items []rune) map[rune]lang.PlaceholderType {
 	return ret
 }
 
+func createWordSet(items []string) map[string]lang.PlaceholderType {
+	ret := make(map[string]lang.PlaceholderType)
+	for _, item := range items {
+		ret[item] = lang.Placeholder
+	}
+	return ret
+}
+
 func isAscii(s string) bool {
 	for i := 0; i < len(s); i++ {
 		if s[i] > unicode.MaxASCII {
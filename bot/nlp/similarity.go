@@ -0,0 +1,120 @@
+package nlp
+
+import (
+	"math/bits"
+	"unicode/utf8"
+)
+
+// boundInterval is the number of the runes of the target between the checks of
+// whether it can still be similar enough.
+const boundInterval = 4
+
+// SimilarityMatcher scores the similarity of the targets to a source by the
+// same measure as SimilarityForStrings, with the source preprocessed once.
+//
+// With the costs of DefaultOptions, the edit distance is the number of the
+// runes out of the longest common subsequence (LCS) of the strings, which is
+// computed bit-parallel, 64 runes of the source a word, like Myers' algorithm.
+type SimilarityMatcher struct {
+	length int
+	// the bit i of the masks of a rune is set if the source has it at i
+	masks map[rune][]uint64
+	// the mask of the runes out of the source
+	empty []uint64
+}
+
+// NewSimilarityMatcher returns a SimilarityMatcher of the source.
+func NewSimilarityMatcher(source string) *SimilarityMatcher {
+	runes := []rune(source)
+	words := (len(runes) + 63) / 64
+	masks := make(map[rune][]uint64)
+	for i, r := range runes {
+		mask, ok := masks[r]
+		if !ok {
+			mask = make([]uint64, words)
+			masks[r] = mask
+		}
+		mask[i/64] |= 1 << uint(i%64)
+	}
+
+	return &SimilarityMatcher{
+		length: len(runes),
+		masks:  masks,
+		empty:  make([]uint64, words),
+	}
+}
+
+// Similarity returns the similarity of the target to the source.
+func (matcher *SimilarityMatcher) Similarity(target string) float32 {
+	similarity, _ := matcher.SimilarityAbove(target, -1)
+	return similarity
+}
+
+// SimilarityAbove returns the similarity of the target to the source if it is
+// above min, the scoring stops as soon as the target can't make it.
+func (matcher *SimilarityMatcher) SimilarityAbove(target string, min float32) (float32, bool) {
+	length := utf8.RuneCountInString(target)
+	total := matcher.length + length
+	above := func(lcs int) bool {
+		return float32(2*lcs)/float32(total) > min
+	}
+
+	shorter := length
+	if matcher.length < shorter {
+		shorter = matcher.length
+	}
+	if !above(shorter) {
+		return 0, false
+	}
+
+	// the zero bits of vector are the LCS, all ones at first, the vectors of
+	// the sources up to 256 runes are kept on the stack
+	var buffer [4]uint64
+	var vector []uint64
+	if len(matcher.empty) <= len(buffer) {
+		vector = buffer[:len(matcher.empty)]
+	} else {
+		vector = make([]uint64, len(matcher.empty))
+	}
+	for i := range vector {
+		vector[i] = ^uint64(0)
+	}
+
+	var i int
+	for _, r := range target {
+		mask, ok := matcher.masks[r]
+		if !ok {
+			mask = matcher.empty
+		}
+
+		// vector = (vector + (vector & mask)) | (vector &^ mask), word by word
+		var carry uint64
+		for j := range vector {
+			sum, c := bits.Add64(vector[j], vector[j]&mask[j], carry)
+			vector[j] = sum | (vector[j] &^ mask[j])
+			carry = c
+		}
+
+		// the rest of the target can add one to the LCS at most by each rune
+		i++
+		if i%boundInterval == 0 && !above(matcher.lcs(vector)+length-i) {
+			return 0, false
+		}
+	}
+
+	lcs := matcher.lcs(vector)
+	return float32(2*lcs) / float32(total), above(lcs)
+}
+
+// lcs returns the length of the LCS, the zero bits of the vector in the source.
+func (matcher *SimilarityMatcher) lcs(vector []uint64) int {
+	var ones int
+	for i, word := range vector {
+		if rest := matcher.length - i*64; rest < 64 {
+			word &= 1<<uint(rest) - 1
+		}
+		ones += bits.OnesCount64(word)
+	}
+
+	return matcher.length - ones
+}
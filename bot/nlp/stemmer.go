@@ -0,0 +1,224 @@
+package nlp
+
+import "strings"
+
+// Stem returns the stem of the lower cased English word by the Porter
+// stemming algorithm, so that "deploying", "deployed" and "deploys" share the
+// stem "deploi".
+// Words of less than three letters are returned as is.
+func Stem(word string) string {
+	if len(word) < 3 || strings.IndexFunc(word, func(r rune) bool {
+		return r < 'a' || r > 'z'
+	}) >= 0 {
+		return word
+	}
+
+	s := &stemmer{b: []byte(word)}
+	s.step1ab()
+	s.step1c()
+	s.step2()
+	s.step3()
+	s.step4()
+	s.step5()
+	return string(s.b)
+}
+
+// stemmer holds the word being stemmed, j is the end of the stem before the
+// suffix being checked.
+type stemmer struct {
+	b []byte
+	j int
+}
+
+// cons reports whether b[i] is a consonant.
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	default:
+		return true
+	}
+}
+
+// measure returns the number of the vowel consonant sequences in b[:j+1].
+func (s *stemmer) measure() int {
+	n, i := 0, 0
+	for ; i <= s.j && s.cons(i); i++ {
+	}
+	for i <= s.j {
+		for ; i <= s.j && !s.cons(i); i++ {
+		}
+		if i > s.j {
+			break
+		}
+		n++
+		for ; i <= s.j && s.cons(i); i++ {
+		}
+	}
+	return n
+}
+
+// vowelInStem reports whether b[:j+1] contains a vowel.
+func (s *stemmer) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleCons reports whether b[i-1:i+1] is a double consonant.
+func (s *stemmer) doubleCons(i int) bool {
+	return i >= 1 && s.b[i] == s.b[i-1] && s.cons(i)
+}
+
+// cvc reports whether b[i-2:i+1] is consonant, vowel, consonant and the last
+// one is not w, x or y, like "hop" in "hoping".
+func (s *stemmer) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+	switch s.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether the word ends with suffix, and sets j before it.
+func (s *stemmer) ends(suffix string) bool {
+	if len(suffix) > len(s.b) || string(s.b[len(s.b)-len(suffix):]) != suffix {
+		return false
+	}
+	s.j = len(s.b) - len(suffix) - 1
+	return true
+}
+
+// setTo replaces the suffix after j with text.
+func (s *stemmer) setTo(text string) {
+	s.b = append(s.b[:s.j+1], text...)
+}
+
+// replace replaces the suffix with text if the stem has a positive measure.
+func (s *stemmer) replace(text string) {
+	if s.measure() > 0 {
+		s.setTo(text)
+	}
+}
+
+func (s *stemmer) step1ab() {
+	if s.b[len(s.b)-1] == 's' {
+		switch {
+		case s.ends("sses"):
+			s.b = s.b[:len(s.b)-2]
+		case s.ends("ies"):
+			s.setTo("i")
+		case len(s.b) > 1 && s.b[len(s.b)-2] != 's':
+			s.b = s.b[:len(s.b)-1]
+		}
+	}
+
+	if s.ends("eed") {
+		if s.measure() > 0 {
+			s.b = s.b[:len(s.b)-1]
+		}
+	} else if (s.ends("ed") || s.ends("ing")) && s.vowelInStem() {
+		s.b = s.b[:s.j+1]
+		switch {
+		case s.ends("at"):
+			s.setTo("ate")
+		case s.ends("bl"):
+			s.setTo("ble")
+		case s.ends("iz"):
+			s.setTo("ize")
+		case s.doubleCons(len(s.b) - 1):
+			switch s.b[len(s.b)-1] {
+			case 'l', 's', 'z':
+			default:
+				s.b = s.b[:len(s.b)-1]
+			}
+		default:
+			s.j = len(s.b) - 1
+			if s.measure() == 1 && s.cvc(len(s.b)-1) {
+				s.b = append(s.b, 'e')
+			}
+		}
+	}
+}
+
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[len(s.b)-1] = 'i'
+	}
+}
+
+var (
+	step2Suffixes = [][2]string{
+		{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+		{"izer", "ize"}, {"bli", "ble"}, {"alli", "al"}, {"entli", "ent"},
+		{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+		{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+		{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+		{"logi", "log"},
+	}
+	step3Suffixes = [][2]string{
+		{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+		{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+	}
+	step4Suffixes = []string{
+		"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+		"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+	}
+)
+
+func (s *stemmer) step2() {
+	for _, suffix := range step2Suffixes {
+		if s.ends(suffix[0]) {
+			s.replace(suffix[1])
+			return
+		}
+	}
+}
+
+func (s *stemmer) step3() {
+	for _, suffix := range step3Suffixes {
+		if s.ends(suffix[0]) {
+			s.replace(suffix[1])
+			return
+		}
+	}
+}
+
+func (s *stemmer) step4() {
+	for _, suffix := range step4Suffixes {
+		if !s.ends(suffix) {
+			continue
+		}
+		// -ion is only removed after s or t
+		if suffix == "ion" && (s.j < 0 || s.b[s.j] != 's' && s.b[s.j] != 't') {
+			return
+		}
+		if s.measure() > 1 {
+			s.b = s.b[:s.j+1]
+		}
+		return
+	}
+}
+
+func (s *stemmer) step5() {
+	s.j = len(s.b) - 1
+	if s.b[len(s.b)-1] == 'e' {
+		s.j = len(s.b) - 2
+		if m := s.measure(); m > 1 || m == 1 && !s.cvc(len(s.b)-2) {
+			s.b = s.b[:len(s.b)-1]
+		}
+	}
+
+	s.j = len(s.b) - 1
+	if s.b[len(s.b)-1] == 'l' && s.doubleCons(len(s.b)-1) && s.measure() > 1 {
+		s.b = s.b[:len(s.b)-1]
+	}
+}
@@ -0,0 +1,148 @@
+package nlp
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tal-tech/go-zero/core/lang"
+	"github.com/wangbin/jiebago"
+	"github.com/wangbin/jiebago/dictionary"
+)
+
+// The default dictionaries in the working directory.
+const (
+	DictFile      = "dict.txt"
+	IdfFile       = "idf.txt"
+	StopWordsFile = "stop_words.txt"
+)
+
+type (
+	// Terms segments sentences into terms with jieba and weights the terms
+	// by their IDFs.
+	Terms struct {
+		segmenter *jiebago.Segmenter
+		idf       IdfTable
+		medianIdf float64
+		stopWords StopWordSet
+		english   *EnglishTokenizer
+	}
+
+	// IdfTable is the IDFs of the words, which loads from the IDF dictionaries.
+	IdfTable map[string]float64
+	// StopWordSet is the stop words, which loads from the stop word files.
+	StopWordSet map[string]lang.PlaceholderType
+)
+
+// LoadTerms loads the jieba dictionary, the IDF table and the stop words,
+// the user dictionaries are merged on top of the jieba dictionary in order.
+func LoadTerms(dictFile, idfFile, stopWordsFile string, userDictFiles ...string) (*Terms, error) {
+	var segmenter jiebago.Segmenter
+	if err := segmenter.LoadDictionary(dictFile); err != nil {
+		return nil, err
+	}
+	for _, file := range userDictFiles {
+		if err := segmenter.LoadUserDictionary(file); err != nil {
+			return nil, err
+		}
+	}
+
+	idf := make(IdfTable)
+	if err := dictionary.LoadDictionary(idf, idfFile); err != nil {
+		return nil, err
+	}
+
+	stopWords := make(StopWordSet)
+	if err := dictionary.LoadDictionary(stopWords, stopWordsFile); err != nil {
+		return nil, err
+	}
+
+	return &Terms{
+		segmenter: &segmenter,
+		idf:       idf,
+		medianIdf: idf.Median(),
+		stopWords: stopWords,
+		english:   NewEnglishTokenizer(),
+	}, nil
+}
+
+// Cut returns the lower cased terms of the sentence, without stop words,
+// spaces and punctuations. The English words are stemmed, so that the
+// English and the mixed sentences match by their word stems.
+func (terms *Terms) Cut(sentence string) []string {
+	var result []string
+	for _, run := range splitScripts(sentence) {
+		if run.latin {
+			result = append(result, terms.english.Tokenize(run.text)...)
+		} else {
+			result = append(result, terms.cutChinese(run.text)...)
+		}
+	}
+
+	return result
+}
+
+func (terms *Terms) cutChinese(sentence string) []string {
+	var result []string
+	for word := range terms.segmenter.Cut(sentence, true) {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if strings.IndexFunc(word, isWordRune) < 0 {
+			continue
+		}
+		if _, ok := terms.stopWords[word]; ok {
+			continue
+		}
+
+		result = append(result, word)
+	}
+
+	return result
+}
+
+// Idf returns the IDF of the term, the median IDF for unknown terms.
+func (terms *Terms) Idf(term string) float64 {
+	if idf, ok := terms.idf[term]; ok {
+		return idf
+	}
+
+	return terms.medianIdf
+}
+
+func (table IdfTable) AddToken(token dictionary.Token) {
+	table[token.Text()] = token.Frequency()
+}
+
+func (table IdfTable) Load(ch <-chan dictionary.Token) {
+	for token := range ch {
+		table.AddToken(token)
+	}
+}
+
+// Median returns the median of the IDFs, which is the IDF of the unknown words.
+func (table IdfTable) Median() float64 {
+	if len(table) == 0 {
+		return 0
+	}
+
+	idfs := make([]float64, 0, len(table))
+	for _, idf := range table {
+		idfs = append(idfs, idf)
+	}
+	sort.Float64s(idfs)
+
+	return idfs[len(idfs)/2]
+}
+
+func (set StopWordSet) AddToken(token dictionary.Token) {
+	set[token.Text()] = lang.Placeholder
+}
+
+func (set StopWordSet) Load(ch <-chan dictionary.Token) {
+	for token := range ch {
+		set.AddToken(token)
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
@@ -0,0 +1,54 @@
+package nlp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// loadTestTerms loads the terms from the given jieba dictionary, IDF table
+// and stop words.
+func loadTestTerms(t *testing.T, dict, idf, stopWords string) *Terms {
+	dir := t.TempDir()
+	files := make([]string, 3)
+	for i, content := range []string{dict, idf, stopWords} {
+		files[i] = filepath.Join(dir, []string{"dict.txt", "idf.txt", "stop_words.txt"}[i])
+		if err := ioutil.WriteFile(files[i], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	terms, err := LoadTerms(files[0], files[1], files[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return terms
+}
+
+func TestTermsIdf(t *testing.T) {
+	terms := loadTestTerms(t, "重启 100 v\n服务 100 n\n的 100 u\n", "重启 4.5\n服务 2.5\nrestart 3\nlog 1.5\n", "的\n")
+
+	for term, expect := range map[string]float64{
+		"重启":      4.5,
+		"restart": 3,
+		"log":     1.5,
+		// the median of the table for the unknown terms
+		"unknown": 3,
+	} {
+		if idf := terms.Idf(term); idf != expect {
+			t.Fatalf("%s: expected IDF %v, got %v", term, expect, idf)
+		}
+	}
+
+	if words := terms.Cut("重启的服务"); !reflect.DeepEqual(words, []string{"重启", "服务"}) {
+		t.Fatalf("expected the stop words dropped, got %v", words)
+	}
+	if words := terms.Cut("Restarting the logs"); !reflect.DeepEqual(words, []string{"restart", "log"}) {
+		t.Fatalf("expected the English words stemmed, got %v", words)
+	}
+	if words := terms.Cut("重启deploying服务"); !reflect.DeepEqual(words, []string{"重启", "deploi", "服务"}) {
+		t.Fatalf("expected the English words of the mixed sentence stemmed, got %v", words)
+	}
+}
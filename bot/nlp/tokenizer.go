@@ -0,0 +1,167 @@
+package nlp
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/tal-tech/go-zero/core/lang"
+)
+
+// The languages of the sentences.
+const (
+	UnknownLanguage Language = iota
+	Chinese
+	English
+	// Mixed is the Chinese sentences with English words, or the other way
+	Mixed
+)
+
+// minorLanguageRatio is the share of the letters in the other language that
+// makes a sentence mixed.
+const minorLanguageRatio = 0.2
+
+type (
+	// Language is the language of a sentence.
+	Language int
+
+	// EnglishTokenizer splits the latin words, drops the stop words and stems
+	// the others, the characters of the other scripts separate the words.
+	EnglishTokenizer struct {
+		stopWords StopWordSet
+	}
+)
+
+var englishStopWords = []string{
+	"a", "about", "above", "after", "again", "all", "am", "an", "and", "any", "are", "as", "at",
+	"be", "because", "been", "before", "being", "below", "between", "both", "but", "by",
+	"could", "did", "do", "does", "doing", "down", "during", "each", "few", "for", "from",
+	"further", "had", "has", "have", "having", "he", "her", "here", "hers", "herself", "him",
+	"himself", "his", "i", "if", "in", "into", "is", "it", "its", "itself", "just", "me",
+	"more", "most", "my", "myself", "no", "nor", "of", "off", "on", "once", "only", "or",
+	"other", "our", "ours", "ourselves", "out", "over", "own", "s", "same", "she", "should",
+	"so", "some", "such", "t", "than", "that", "the", "their", "theirs", "them", "themselves",
+	"then", "there", "these", "they", "this", "those", "through", "to", "too", "under",
+	"until", "up", "very", "was", "we", "were", "while", "with", "would", "you", "your",
+	"yours", "yourself", "yourselves",
+}
+
+// DetectLanguage detects the language of the sentence by its letters, the
+// Han characters for Chinese and the latin letters for English.
+func DetectLanguage(sentence string) Language {
+	var han, latin int
+	for _, r := range sentence {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case isLatin(r):
+			latin++
+		}
+	}
+
+	switch {
+	case han == 0 && latin == 0:
+		return UnknownLanguage
+	case float64(latin) < float64(han+latin)*minorLanguageRatio:
+		return Chinese
+	case float64(han) < float64(han+latin)*minorLanguageRatio:
+		return English
+	default:
+		return Mixed
+	}
+}
+
+func (language Language) String() string {
+	switch language {
+	case Chinese:
+		return "chinese"
+	case English:
+		return "english"
+	case Mixed:
+		return "mixed"
+	default:
+		return "unknown"
+	}
+}
+
+// NewEnglishTokenizer returns an English tokenizer with the common English
+// stop words.
+func NewEnglishTokenizer() *EnglishTokenizer {
+	stopWords := make(StopWordSet, len(englishStopWords))
+	for _, word := range englishStopWords {
+		stopWords[word] = lang.Placeholder
+	}
+
+	return &EnglishTokenizer{
+		stopWords: stopWords,
+	}
+}
+
+// Tokenize returns the stems of the latin words in the sentence, the digits
+// in the words are kept, like "k8s" and "utf8".
+func (tokenizer *EnglishTokenizer) Tokenize(sentence string) []string {
+	var result []string
+	words := strings.FieldsFunc(strings.ToLower(sentence), func(r rune) bool {
+		return !isLatin(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	for _, word := range words {
+		// the possessives and the contractions are the words themselves
+		if index := strings.IndexByte(word, '\''); index >= 0 {
+			word = word[:index]
+		}
+		if strings.IndexFunc(word, isLatin) < 0 {
+			continue
+		}
+		if _, ok := tokenizer.stopWords[word]; ok {
+			continue
+		}
+
+		result = append(result, Stem(word))
+	}
+
+	return result
+}
+
+// IsStopWord reports whether the lower cased word is an English stop word.
+func (tokenizer *EnglishTokenizer) IsStopWord(word string) bool {
+	_, ok := tokenizer.stopWords[word]
+	return ok
+}
+
+type scriptRun struct {
+	text  string
+	latin bool
+}
+
+// splitScripts splits the sentence into the runs of the latin words and the
+// runs of the other text, the digits, the spaces and the punctuations go
+// with the run they are in.
+func splitScripts(sentence string) []scriptRun {
+	var runs []scriptRun
+	start := 0
+	latin := false
+	for i, r := range sentence {
+		switch {
+		case isLatin(r):
+			if !latin && i > start {
+				runs = append(runs, scriptRun{text: sentence[start:i]})
+				start = i
+			}
+			latin = true
+		case unicode.Is(unicode.Han, r) || unicode.IsLetter(r):
+			if latin {
+				runs = append(runs, scriptRun{text: sentence[start:i], latin: true})
+				start = i
+			}
+			latin = false
+		}
+	}
+	if start < len(sentence) {
+		runs = append(runs, scriptRun{text: sentence[start:], latin: latin})
+	}
+
+	return runs
+}
+
+func isLatin(r rune) bool {
+	return r < unicode.MaxLatin1 && unicode.IsLetter(r)
+}
@@ -0,0 +1,81 @@
+package nlp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"caresses":   "caress",
+		"ponies":     "poni",
+		"cats":       "cat",
+		"deploying":  "deploi",
+		"deployed":   "deploi",
+		"deploys":    "deploi",
+		"agreed":     "agre",
+		"hopping":    "hop",
+		"hoping":     "hope",
+		"falling":    "fall",
+		"relational": "relat",
+		"happy":      "happi",
+		"generalize": "gener",
+		"adjustment": "adjust",
+		"controll":   "control",
+		"k8s":        "k8s",
+		"is":         "is",
+	}
+
+	for word, stem := range tests {
+		if actual := Stem(word); actual != stem {
+			t.Errorf("Stem(%s): expected %s, got %s", word, stem, actual)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]Language{
+		"怎么登录平台":                       Chinese,
+		"How do I deploy the service?": English,
+		"怎么用 kubectl 部署":               Mixed,
+		"怎么登录蓝鲸平台的k8s":                 Chinese,
+		"12345 ?":                      UnknownLanguage,
+	}
+
+	for sentence, language := range tests {
+		if actual := DetectLanguage(sentence); actual != language {
+			t.Errorf("DetectLanguage(%s): expected %s, got %s", sentence, language, actual)
+		}
+	}
+}
+
+func TestEnglishTokenizer(t *testing.T) {
+	tokens := NewEnglishTokenizer().Tokenize("How do I restart the deployed services on k8s? It's 部署")
+	expected := []string{"how", "restart", "deploi", "servic", "k8s"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("expected %v, got %v", expected, tokens)
+	}
+}
+
+func TestIsQuestion(t *testing.T) {
+	tests := map[string]bool{
+		"怎么登录":                      true,
+		"登录平台吗":                     true,
+		"登录平台":                      false,
+		"How do I deploy":           true,
+		"what's the version":        true,
+		"Can I restart it":          true,
+		"can't you see":             true,
+		"Is the service down":       true,
+		"Do restart it":             false,
+		"Can opener is on the desk": false,
+		"The service is down":       false,
+		"restart the service?":      true,
+	}
+
+	for sentence, question := range tests {
+		if actual := IsQuestion(sentence); actual != question {
+			t.Errorf("IsQuestion(%s): expected %t, got %t", sentence, question, actual)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package nlp
+
+import (
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	lshTables  = 10
+	lshBits    = 8
+	lshSeed    = 20211019
+	exactLimit = 5000
+)
+
+type (
+	// VectorIndex is an approximate nearest neighbour index of vectors by
+	// random hyperplane LSH, small indexes are searched exhaustively.
+	VectorIndex struct {
+		embedder string
+		keys     []string
+		vectors  [][]float32
+		planes   [][][]float32
+		// signatures[i][t] is the bucket of the i-th vector in table t
+		signatures [][]uint32
+		buckets    []map[uint32][]int
+		// the digest of the keys, to tell if the keys are changed
+		digest uint64
+	}
+
+	// KeyAndScore is a key found in a VectorIndex with its similarity.
+	KeyAndScore struct {
+		Key   string
+		Score float32
+	}
+
+	vectorIndexFile struct {
+		Embedder   string
+		Keys       []string
+		Vectors    [][]float32
+		Signatures [][]uint32
+	}
+)
+
+// BuildVectorIndex embeds the keys with the embedder and indexes them.
+func BuildVectorIndex(embedder Embedder, keys []string) *VectorIndex {
+	index := newVectorIndex(embedder.Name(), embedder.Dimension())
+	for _, key := range keys {
+		vector := embedder.Embed(key)
+		index.add(key, vector, index.signature(vector))
+	}
+
+	return index
+}
+
+// LoadVectorIndex loads the index saved in file, which must be built by the
+// given embedder.
+func LoadVectorIndex(file string, embedder Embedder) (*VectorIndex, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var content vectorIndexFile
+	if err := gob.NewDecoder(f).Decode(&content); err != nil {
+		return nil, err
+	}
+
+	if content.Embedder != embedder.Name() {
+		return nil, fmt.Errorf("%s: built by embedder %s, not %s", file, content.Embedder, embedder.Name())
+	}
+
+	if err := content.validate(embedder.Dimension()); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	index := newVectorIndex(content.Embedder, embedder.Dimension())
+	for i := range content.Keys {
+		index.add(content.Keys[i], content.Vectors[i], content.Signatures[i])
+	}
+
+	return index, nil
+}
+
+// validate checks that the content has a vector of the dimension and the
+// signature of all the tables for each key, which a truncated file doesn't.
+func (content vectorIndexFile) validate(dimension int) error {
+	if len(content.Vectors) != len(content.Keys) || len(content.Signatures) != len(content.Keys) {
+		return fmt.Errorf("%d keys with %d vectors and %d signatures", len(content.Keys),
+			len(content.Vectors), len(content.Signatures))
+	}
+
+	for i := range content.Keys {
+		if len(content.Vectors[i]) != dimension {
+			return fmt.Errorf("vector %d of dimension %d, not %d", i, len(content.Vectors[i]), dimension)
+		}
+		if len(content.Signatures[i]) != lshTables {
+			return fmt.Errorf("signature %d of %d tables, not %d", i, len(content.Signatures[i]), lshTables)
+		}
+	}
+
+	return nil
+}
+
+// KeysDigest returns the digest of the keys regardless of their order, an
+// index is built from the same keys if it has the same digest.
+func KeysDigest(keys []string) uint64 {
+	var digest uint64
+	for _, key := range keys {
+		digest += keyDigest(key)
+	}
+
+	return digest
+}
+
+// Digest returns the digest of the keys of the index, the same as KeysDigest.
+func (index *VectorIndex) Digest() uint64 {
+	return index.digest
+}
+
+func (index *VectorIndex) Len() int {
+	return len(index.keys)
+}
+
+// Save writes the index into a temp file and renames it to file.
+func (index *VectorIndex) Save(file string) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(f).Encode(vectorIndexFile{
+		Embedder:   index.embedder,
+		Keys:       index.keys,
+		Vectors:    index.vectors,
+		Signatures: index.signatures,
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), file)
+}
+
+// Search returns up to tops keys with the most similar vectors, the buckets
+// of the signatures one bit away are probed as well.
+func (index *VectorIndex) Search(vector []float32, tops int) []KeyAndScore {
+	var candidates []int
+	if len(index.keys) <= exactLimit {
+		candidates = make([]int, len(index.keys))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	} else {
+		seen := make(map[int]bool)
+		for t, signature := range index.signature(vector) {
+			for bit := -1; bit < lshBits; bit++ {
+				probe := signature
+				if bit >= 0 {
+					probe ^= 1 << uint(bit)
+				}
+				for _, id := range index.buckets[t][probe] {
+					if !seen[id] {
+						seen[id] = true
+						candidates = append(candidates, id)
+					}
+				}
+			}
+		}
+	}
+
+	result := make([]KeyAndScore, 0, len(candidates))
+	for _, id := range candidates {
+		result = append(result, KeyAndScore{
+			Key:   index.keys[id],
+			Score: CosineSimilarity(vector, index.vectors[id]),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Score > result[j].Score
+	})
+	if len(result) > tops {
+		result = result[:tops]
+	}
+
+	return result
+}
+
+func (index *VectorIndex) add(key string, vector []float32, signature []uint32) {
+	id := len(index.keys)
+	index.keys = append(index.keys, key)
+	index.vectors = append(index.vectors, vector)
+	index.signatures = append(index.signatures, signature)
+	index.digest += keyDigest(key)
+	for t, bucket := range signature {
+		index.buckets[t][bucket] = append(index.buckets[t][bucket], id)
+	}
+}
+
+func (index *VectorIndex) signature(vector []float32) []uint32 {
+	signature := make([]uint32, lshTables)
+	for t := range index.planes {
+		for bit, plane := range index.planes[t] {
+			if CosineSimilarity(plane, vector) >= 0 {
+				signature[t] |= 1 << uint(bit)
+			}
+		}
+	}
+
+	return signature
+}
+
+func keyDigest(key string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return hash.Sum64()
+}
+
+// newVectorIndex creates an empty index, the hyperplanes are generated from
+// a fixed seed, so that the saved signatures stay valid.
+func newVectorIndex(embedder string, dimension int) *VectorIndex {
+	random := rand.New(rand.NewSource(lshSeed))
+	planes := make([][][]float32, lshTables)
+	buckets := make([]map[uint32][]int, lshTables)
+	for t := range planes {
+		planes[t] = make([][]float32, lshBits)
+		for bit := range planes[t] {
+			plane := make([]float32, dimension)
+			for i := range plane {
+				plane[i] = float32(random.NormFloat64())
+			}
+			planes[t][bit] = plane
+		}
+		buckets[t] = make(map[uint32][]int)
+	}
+
+	return &VectorIndex{
+		embedder: embedder,
+		planes:   planes,
+		buckets:  buckets,
+	}
+}
@@ -0,0 +1,115 @@
+package nlp
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVectorIndex(t *testing.T) {
+	embedder := NewNgramEmbedder(256, 1, 3)
+	keys := []string{"how to restart the service", "where are the logs kept", "how to rotate the certificates"}
+	index := BuildVectorIndex(embedder, keys)
+	if index.Len() != 3 || index.Digest() != KeysDigest(keys) {
+		t.Fatalf("unexpected index of %d keys", index.Len())
+	}
+
+	results := index.Search(embedder.Embed("restart the service"), 2)
+	if len(results) != 2 || results[0].Key != "how to restart the service" || results[0].Score < results[1].Score {
+		t.Fatalf("expected the nearest key first, got %v", results)
+	}
+
+	file := filepath.Join(t.TempDir(), "index.ann")
+	if err := index.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadVectorIndex(file, embedder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Digest() != index.Digest() {
+		t.Fatal("expected the same digest after loading")
+	}
+	if reloaded := loaded.Search(embedder.Embed("restart the service"), 2); !reflect.DeepEqual(reloaded, results) {
+		t.Fatalf("expected the same results after loading, got %v", reloaded)
+	}
+
+	if _, err := LoadVectorIndex(file, NewNgramEmbedder(128, 1, 3)); err == nil {
+		t.Fatal("expected error loading the index of another embedder")
+	}
+}
+
+func TestVectorIndexLSH(t *testing.T) {
+	embedder := NewNgramEmbedder(64, 1, 3)
+	keys := make([]string, exactLimit+100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("question number %d", i)
+	}
+	index := BuildVectorIndex(embedder, keys)
+
+	results := index.Search(embedder.Embed("question number 4321"), 1)
+	if len(results) != 1 || results[0].Key != "question number 4321" {
+		t.Fatalf("expected the same key probed, got %v", results)
+	}
+}
+
+func TestKeysDigest(t *testing.T) {
+	keys := []string{"first", "second", "third"}
+	if KeysDigest(keys) != KeysDigest([]string{"third", "first", "second"}) {
+		t.Fatal("expected the digest regardless of the order")
+	}
+	// a replaced key keeps the number of the keys
+	if KeysDigest(keys) == KeysDigest([]string{"first", "second", "fourth"}) {
+		t.Fatal("expected another digest of a replaced key")
+	}
+}
+
+func TestLoadVectorIndexMalformed(t *testing.T) {
+	embedder := NewNgramEmbedder(16, 1, 3)
+	index := BuildVectorIndex(embedder, []string{"first", "second"})
+	tests := map[string]vectorIndexFile{
+		"missing vectors": {
+			Keys:       index.keys,
+			Vectors:    index.vectors[:1],
+			Signatures: index.signatures,
+		},
+		"missing signatures": {
+			Keys:       index.keys,
+			Vectors:    index.vectors,
+			Signatures: index.signatures[:1],
+		},
+		"short vector": {
+			Keys:       index.keys,
+			Vectors:    [][]float32{index.vectors[0], index.vectors[1][:8]},
+			Signatures: index.signatures,
+		},
+		"short signature": {
+			Keys:       index.keys,
+			Vectors:    index.vectors,
+			Signatures: [][]uint32{index.signatures[0], index.signatures[1][:3]},
+		},
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "index.ann")
+			f, err := os.Create(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content.Embedder = embedder.Name()
+			err = gob.NewEncoder(f).Encode(content)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := LoadVectorIndex(file, embedder); err == nil {
+				t.Fatal("expected the malformed index to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package rich
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MaxAssetSize is the largest asset to save, in bytes.
+const MaxAssetSize = 5 << 20
+
+var assetExtensions = map[string]bool{
+	".gif":  true,
+	".jpeg": true,
+	".jpg":  true,
+	".png":  true,
+	".webp": true,
+}
+
+// AssetStore keeps the images of the rich answers in a local directory, which
+// is served under prefix. The assets are named by the digests of their
+// contents, so saving the same image twice gives the same url.
+type AssetStore struct {
+	dir    string
+	prefix string
+}
+
+// NewAssetStore creates the asset store of dir if it doesn't exist.
+func NewAssetStore(dir, prefix string) (*AssetStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &AssetStore{
+		dir:    dir,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}, nil
+}
+
+// Dir returns the directory of the assets.
+func (store *AssetStore) Dir() string {
+	return store.dir
+}
+
+// Save saves the image read from reader, name is the uploaded file name which
+// decides the image type. It returns the url of the asset to use in blocks.
+func (store *AssetStore) Save(name string, reader io.Reader) (string, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if !assetExtensions[ext] {
+		return "", fmt.Errorf("unsupported asset type %q", ext)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, MaxAssetSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MaxAssetSize {
+		return "", fmt.Errorf("asset is larger than %d bytes", MaxAssetSize)
+	}
+
+	sum := md5.Sum(data)
+	file := hex.EncodeToString(sum[:]) + ext
+	if err := ioutil.WriteFile(filepath.Join(store.dir, file), data, 0644); err != nil {
+		return "", err
+	}
+
+	return path.Join(store.prefix, file), nil
+}
@@ -0,0 +1,125 @@
+package rich
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The types of the blocks.
+const (
+	Markdown = "markdown"
+	Code     = "code"
+	Link     = "link"
+	Button   = "button"
+	Image    = "image"
+)
+
+// Block is a typed part of a rich answer. Text is the markdown or the code,
+// the title of a link or a button, or the alternative text of an image.
+// Value is the question sent back when a button is clicked, it defaults to
+// the title. URL is the target of a link, or the location of an image, which
+// is either absolute or a path of the local asset store.
+type Block struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Language string `json:"language,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+// Parse parses the blocks from a JSON array, an empty text has no blocks.
+func Parse(text string) ([]Block, error) {
+	if len(strings.TrimSpace(text)) == 0 {
+		return nil, nil
+	}
+
+	var blocks []Block
+	if err := json.Unmarshal([]byte(text), &blocks); err != nil {
+		return nil, fmt.Errorf("bad rich content: %v", err)
+	}
+
+	for i := range blocks {
+		if err := blocks[i].validate(); err != nil {
+			return nil, fmt.Errorf("block %d: %v", i, err)
+		}
+		if blocks[i].Type == Button && len(blocks[i].Value) == 0 {
+			blocks[i].Value = blocks[i].Text
+		}
+	}
+
+	return blocks, nil
+}
+
+// Plain renders the blocks as plain text for the clients that can't show
+// rich content, one block per line.
+func Plain(blocks []Block) string {
+	var lines []string
+	var buttons []string
+	for _, block := range blocks {
+		if block.Type == Button {
+			buttons = append(buttons, "["+block.Text+"]")
+			continue
+		}
+		if len(buttons) > 0 {
+			lines = append(lines, strings.Join(buttons, " "))
+			buttons = nil
+		}
+
+		switch block.Type {
+		case Markdown:
+			lines = append(lines, block.Text)
+		case Code:
+			lines = append(lines, "```"+block.Language, strings.TrimRight(block.Text, "\n"), "```")
+		case Link:
+			if len(block.Text) == 0 {
+				lines = append(lines, block.URL)
+			} else {
+				lines = append(lines, block.Text+": "+block.URL)
+			}
+		case Image:
+			if len(block.Text) == 0 {
+				lines = append(lines, "[image] "+block.URL)
+			} else {
+				lines = append(lines, "[image: "+block.Text+"] "+block.URL)
+			}
+		}
+	}
+	if len(buttons) > 0 {
+		lines = append(lines, strings.Join(buttons, " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (block Block) validate() error {
+	switch block.Type {
+	case Markdown, Code:
+		if len(block.Text) == 0 {
+			return fmt.Errorf("%s without text", block.Type)
+		}
+	case Button:
+		if len(block.Text) == 0 {
+			return fmt.Errorf("button without title")
+		}
+	case Link, Image:
+		if len(block.URL) == 0 {
+			return fmt.Errorf("%s without url", block.Type)
+		}
+		if !safeURL(block.URL) {
+			return fmt.Errorf("%s with unsupported url %q", block.Type, block.URL)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", block.Type)
+	}
+
+	return nil
+}
+
+// safeURL reports whether url is a web address or a path of the site, so
+// that the clients won't follow a javascript: or a data: url.
+func safeURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") ||
+		strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//")
+}
@@ -0,0 +1,50 @@
+package rich
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{"", true},
+		{`[{"type":"markdown","text":"**hi**"}]`, true},
+		{`[{"type":"link","text":"doc","url":"https://example.com/doc"}]`, true},
+		{`[{"type":"image","url":"/assets/a.png"}]`, true},
+		{`[{"type":"image","url":"//example.com/a.png"}]`, false},
+		{`[{"type":"link","url":"javascript:alert(1)"}]`, false},
+		{`[{"type":"code"}]`, false},
+		{`[{"type":"video","url":"/a.mp4"}]`, false},
+		{`{"type":"markdown"}`, false},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.text)
+		if (err == nil) != test.ok {
+			t.Errorf("Parse(%s): %v", test.text, err)
+		}
+	}
+}
+
+func TestPlain(t *testing.T) {
+	blocks, err := Parse(`[
+		{"type":"markdown","text":"Restart the service:"},
+		{"type":"code","language":"sh","text":"systemctl restart app\n"},
+		{"type":"link","text":"runbook","url":"https://example.com/runbook"},
+		{"type":"image","text":"dashboard","url":"/assets/a.png"},
+		{"type":"button","text":"Solved"},
+		{"type":"button","text":"Still broken","value":"it is still broken"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks[4].Value != "Solved" {
+		t.Errorf("button value: %q", blocks[4].Value)
+	}
+
+	expect := "Restart the service:\n```sh\nsystemctl restart app\n```\nrunbook: https://example.com/runbook\n" +
+		"[image: dashboard] /assets/a.png\n[Solved] [Still broken]"
+	if text := Plain(blocks); text != expect {
+		t.Errorf("Plain:\n%s\nexpect:\n%s", text, expect)
+	}
+}
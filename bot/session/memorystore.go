@@ -0,0 +1,48 @@
+package session
+
+import (
+	"time"
+
+	"github.com/tal-tech/go-zero/core/collection"
+)
+
+// memoryStore keeps the sessions in memory, each save renews the TTL.
+type memoryStore struct {
+	cache *collection.Cache
+}
+
+// NewMemoryStore returns a store which keeps up to limit sessions in memory,
+// the least recently used ones are evicted beyond limit.
+func NewMemoryStore(name string, ttl time.Duration, limit int) (Store, error) {
+	cache, err := collection.NewCache(ttl, collection.WithName(name), collection.WithLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryStore{
+		cache: cache,
+	}, nil
+}
+
+// Get returns a copy of the session, which is safe to be modified.
+func (store *memoryStore) Get(id string) (*Session, bool) {
+	value, ok := store.cache.Get(id)
+	if !ok {
+		return nil, false
+	}
+
+	session := value.(Session)
+	session.Turns = append([]Turn(nil), session.Turns...)
+	return &session, true
+}
+
+func (store *memoryStore) Remove(id string) {
+	store.cache.Del(id)
+}
+
+func (store *memoryStore) Save(session *Session) error {
+	value := *session
+	value.Turns = append([]Turn(nil), session.Turns...)
+	store.cache.Set(session.Id, value)
+	return nil
+}
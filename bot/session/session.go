@@ -0,0 +1,69 @@
+package session
+
+import (
+	"time"
+
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+)
+
+type (
+	// Turn is a question of the user and the answer of the bot, CorpusId is
+	// the corpus of the answer, 0 if not answered by a corpus.
+	Turn struct {
+		Question string
+		Answer   string
+		CorpusId int
+		Time     time.Time
+	}
+
+	// Session keeps the recent turns of a conversation, and the intent that
+	// the last answer asks a slot value for, if any.
+	Session struct {
+		Id      string
+		Turns   []Turn
+		Pending *logic.Pending
+	}
+
+	// Store keeps the sessions, sessions not saved within the TTL of the store
+	// expire.
+	Store interface {
+		Get(id string) (*Session, bool)
+		Save(session *Session) error
+		Remove(id string)
+	}
+)
+
+// History returns the sentences of the turns in order, the questions followed
+// by their answers, the unanswered questions are skipped.
+func (session *Session) History() []string {
+	var history []string
+	for _, turn := range session.Turns {
+		if len(turn.Answer) == 0 {
+			continue
+		}
+
+		history = append(history, turn.Question, turn.Answer)
+	}
+
+	return history
+}
+
+// AnsweredBy returns the last question of the session answered by the corpus.
+func (session *Session) AnsweredBy(corpusId int) (string, bool) {
+	for i := len(session.Turns) - 1; i >= 0; i-- {
+		if corpusId > 0 && session.Turns[i].CorpusId == corpusId {
+			return session.Turns[i].Question, true
+		}
+	}
+
+	return "", false
+}
+
+// AddTurn appends the turn and keeps the last maxTurns turns, all turns are
+// kept if maxTurns is not positive.
+func (session *Session) AddTurn(turn Turn, maxTurns int) {
+	session.Turns = append(session.Turns, turn)
+	if maxTurns > 0 && len(session.Turns) > maxTurns {
+		session.Turns = append([]Turn(nil), session.Turns[len(session.Turns)-maxTurns:]...)
+	}
+}
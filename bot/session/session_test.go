@@ -0,0 +1,76 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSessionTurns(t *testing.T) {
+	session := &Session{
+		Id: "id",
+	}
+	session.AddTurn(Turn{Question: "q1", Answer: "a1"}, 2)
+	session.AddTurn(Turn{Question: "q2"}, 2)
+	if history := session.History(); !reflect.DeepEqual(history, []string{"q1", "a1"}) {
+		t.Fatalf("expected the unanswered question skipped, got %v", history)
+	}
+
+	session.AddTurn(Turn{Question: "q3", Answer: "a3"}, 2)
+	if history := session.History(); !reflect.DeepEqual(history, []string{"q3", "a3"}) {
+		t.Fatalf("expected the last 2 turns kept, got %v", history)
+	}
+	if len(session.Turns) != 2 || session.Turns[0].Question != "q2" {
+		t.Fatalf("expected the oldest turn dropped, got %v", session.Turns)
+	}
+
+	session.AddTurn(Turn{Question: "q4", Answer: "a4"}, 0)
+	if len(session.Turns) != 3 {
+		t.Fatalf("expected all turns kept without a limit, got %v", session.Turns)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, err := NewMemoryStore("test", time.Second, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.Get("id"); ok {
+		t.Fatal("expected no session before saved")
+	}
+	session := &Session{
+		Id:    "id",
+		Turns: []Turn{{Question: "q1", Answer: "a1"}},
+	}
+	if err := store.Save(session); err != nil {
+		t.Fatal(err)
+	}
+
+	// the saved and the returned sessions are copies
+	session.Turns[0].Answer = "changed"
+	saved, ok := store.Get("id")
+	if !ok || saved.Turns[0].Answer != "a1" {
+		t.Fatalf("expected the saved session unchanged, got %v", saved)
+	}
+	saved.Turns[0].Answer = "changed"
+	if saved, _ := store.Get("id"); saved.Turns[0].Answer != "a1" {
+		t.Fatalf("expected the stored session unchanged, got %v", saved)
+	}
+
+	store.Remove("id")
+	if _, ok := store.Get("id"); ok {
+		t.Fatal("expected the session removed")
+	}
+
+	// the sessions expire by the TTL, in the granularity of a second
+	store.Save(session)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := store.Get("id"); !ok {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("expected the session expired")
+}
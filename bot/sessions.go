@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+	"github.com/kevwan/chatbot/bot/session"
+	"github.com/kevwan/chatbot/logger"
+)
+
+const (
+	defaultSessionTTL   = 30 * time.Minute
+	defaultSessionTurns = 10
+	maxSessions         = 100000
+)
+
+// NewSessionStore creates the in memory session store of the project, the
+// sessions expire conf.SessionTTL seconds after their last turn, 30 minutes
+// by default.
+func NewSessionStore(conf Config) (session.Store, error) {
+	ttl := defaultSessionTTL
+	if conf.SessionTTL > 0 {
+		ttl = time.Duration(conf.SessionTTL) * time.Second
+	}
+
+	return session.NewMemoryStore("session-"+conf.Project, ttl, maxSessions)
+}
+
+// Converse answers the text in the session of the given id, the recent turns
+// of the session are the history of the conversation. It's the same as
+// RespondWithHistory without history if there is no session store or id.
+func (chatbot *ChatBot) Converse(id, text string, params map[string]string) Response {
+	return chatbot.converse(id, text, params, nil)
+}
+
+// ConverseWithTrace is Converse with the Trace of the response, like
+// RespondWithTrace.
+func (chatbot *ChatBot) ConverseWithTrace(id, text string, params map[string]string) Response {
+	return chatbot.converse(id, text, params, new(logic.Trace))
+}
+
+// AnsweredQuestion returns the last question of the session of the given id
+// that the corpus answered, to tell which question a feedback on the answer is
+// about.
+func (chatbot *ChatBot) AnsweredQuestion(id string, corpusId int) (string, bool) {
+	if chatbot.Sessions == nil || len(id) == 0 {
+		return "", false
+	}
+
+	current, ok := chatbot.Sessions.Get(id)
+	if !ok {
+		return "", false
+	}
+
+	return current.AnsweredBy(corpusId)
+}
+
+func (chatbot *ChatBot) converse(id, text string, params map[string]string, trace *logic.Trace) Response {
+	if chatbot.Sessions == nil || len(id) == 0 {
+		return chatbot.respond(text, nil, nil, params, trace)
+	}
+
+	current, ok := chatbot.Sessions.Get(id)
+	if !ok {
+		current = &session.Session{
+			Id: id,
+		}
+	}
+
+	response := chatbot.respond(text, current.History(), current.Pending, params, trace)
+	turn := session.Turn{
+		Question: text,
+		Time:     time.Now(),
+	}
+	// the pending intent is abandoned unless asked for a slot again
+	current.Pending = nil
+	if len(response.Answers) > 0 {
+		turn.Answer = response.Answers[0].Content
+		turn.CorpusId = response.Answers[0].CorpusId
+		current.Pending = response.Answers[0].Pending
+	}
+
+	turns := chatbot.Config.SessionTurns
+	if turns <= 0 {
+		turns = defaultSessionTurns
+	}
+	current.AddTurn(turn, turns)
+	if err := chatbot.Sessions.Save(current); err != nil {
+		logger.Errorf("session %s: %v", id, err)
+	}
+
+	return response
+}
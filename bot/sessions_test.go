@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+	"github.com/kevwan/chatbot/bot/session"
+)
+
+// historyMatch answers each question with its answers, and keeps the history
+// it's given last.
+type historyMatch struct {
+	answers map[string]string
+	history []string
+}
+
+func (match *historyMatch) CanProcess(string) bool {
+	return true
+}
+
+func (match *historyMatch) Process(text string) []logic.Answer {
+	return match.ProcessWithHistory(text, nil)
+}
+
+func (match *historyMatch) ProcessWithHistory(text string, history []string) []logic.Answer {
+	match.history = history
+	if answer, ok := match.answers[text]; ok {
+		return []logic.Answer{{Content: answer, Confidence: 1}}
+	}
+
+	return nil
+}
+
+func (match *historyMatch) SetVerbose() {
+}
+
+func TestConverseHistory(t *testing.T) {
+	sessions, err := session.NewMemoryStore("test", time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := &historyMatch{
+		answers: map[string]string{
+			"how do i deploy": "which environment",
+			"production":      "run the release pipeline",
+		},
+	}
+	chatbot := &ChatBot{
+		LogicAdapter: match,
+		Sessions:     sessions,
+		Config: Config{
+			SessionTurns: 2,
+		},
+	}
+
+	steps := []struct {
+		id      string
+		text    string
+		history []string
+	}{
+		{
+			id:   "a",
+			text: "how do i deploy",
+		},
+		{
+			id:      "a",
+			text:    "production",
+			history: []string{"how do i deploy", "which environment"},
+		},
+		{
+			// the unanswered questions are not in the history
+			id:      "a",
+			text:    "unknown",
+			history: []string{"how do i deploy", "which environment", "production", "run the release pipeline"},
+		},
+		{
+			// only the last 2 turns are kept
+			id:      "a",
+			text:    "production",
+			history: []string{"production", "run the release pipeline"},
+		},
+		{
+			// the sessions don't share the history
+			id:   "b",
+			text: "production",
+		},
+		{
+			// no session without an id
+			text: "production",
+		},
+	}
+
+	for i, step := range steps {
+		chatbot.Converse(step.id, step.text, nil)
+		if !reflect.DeepEqual(match.history, step.history) {
+			t.Fatalf("step %d: expected history %v, got %v", i, step.history, match.history)
+		}
+	}
+	if _, ok := sessions.Get(""); ok {
+		t.Fatal("expected no session saved without an id")
+	}
+}
+
+func TestConverseExpiredSession(t *testing.T) {
+	sessions, err := session.NewMemoryStore("test-expiry", time.Second, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := &historyMatch{
+		answers: map[string]string{
+			"how do i deploy": "which environment",
+		},
+	}
+	chatbot := &ChatBot{
+		LogicAdapter: match,
+		Sessions:     sessions,
+	}
+
+	chatbot.Converse("a", "how do i deploy", nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := sessions.Get("a"); !ok {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	chatbot.Converse("a", "production", nil)
+	if len(match.history) != 0 {
+		t.Fatalf("expected no history after the session expired, got %v", match.history)
+	}
+}
+
+func TestConversePendingIntent(t *testing.T) {
+	sessions, err := session.NewMemoryStore("test-intent", time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intents := logic.NewIntentSet()
+	if err := intents.Set([]logic.Intent{
+		{
+			Id:        1,
+			Questions: []string{"book a flight"},
+			Slots: []logic.Slot{
+				{Name: "from", Values: []string{"beijing", "shanghai"}, Required: true, Prompt: "which city?"},
+				{Name: "to", Pattern: `to (\w+)`, Required: true, Prompt: "where to?"},
+			},
+			Answer: "flight",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// a corpus answer is the same as the prompt of the intent
+	corpus := &historyMatch{
+		answers: map[string]string{
+			"where do you live": "which city?",
+			"beijing":           "the capital",
+		},
+	}
+	chatbot := &ChatBot{
+		LogicAdapter: logic.NewFallbackMatch(0.6, logic.NewIntentMatch(intents), corpus),
+		Sessions:     sessions,
+		Intents:      intents,
+	}
+
+	steps := []struct {
+		text   string
+		answer string
+	}{
+		{text: "where do you live", answer: "which city?"},
+		// not a slot value, the intent is not asked for
+		{text: "beijing", answer: "the capital"},
+		{text: "book a flight", answer: "which city?"},
+		{text: "beijing", answer: "where to?"},
+		{text: "to shanghai", answer: "flight"},
+		// the intent is done
+		{text: "beijing", answer: "the capital"},
+	}
+	for i, step := range steps {
+		response := chatbot.Converse("a", step.text, nil)
+		if len(response.Answers) == 0 || response.Answers[0].Content != step.answer {
+			t.Fatalf("step %d: expected %s, got %v", i, step.answer, response.Answers)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+)
+
+const (
+	StorageMemory = "memory"
+	StorageBolt   = "bolt"
+
+	ClassifierDefault = "default"
+	ClassifierRules   = "rules"
+)
+
+// NewStorage creates the storage adapter selected by conf.Storage, the store
+// file defaults to the project name with the extension of the storage type.
+// conf.StoreBackups overrides the number of previous generations kept by the
+// memory storage if positive. The questions are segmented by the dictionaries
+// of the project, and conf.CorpusIdf weights their keywords in the memory
+// storage by the IDFs learned from the questions instead of the IDF file.
+// conf.SearchBoth searches both the question and the declarative stores of the
+// memory storage, however the query is classified. conf.Classifier selects how
+// the memory storage tells the questions from the declarative sentences, by the
+// question marks and words by default, or by conf.ClassifierRules first.
+func NewStorage(conf Config) (storage.StorageAdapter, error) {
+	switch conf.Storage {
+	case "", StorageMemory:
+		classifier, err := NewClassifier(conf)
+		if err != nil {
+			return nil, err
+		}
+		store, err := storage.NewSeparatedMemoryStorageWithDictionaries(conf.storePath(), conf.Project,
+			conf.Dictionaries())
+		if err != nil {
+			return nil, err
+		}
+		store.SetClassifier(classifier)
+		if conf.StoreBackups > 0 {
+			store.SetBackups(conf.StoreBackups)
+		}
+		store.SetCorpusIdf(conf.CorpusIdf)
+		store.SetSearchBoth(conf.SearchBoth)
+		return store, nil
+	case StorageBolt:
+		store, err := storage.NewBoltStorageWithDictionaries(conf.storePath(), conf.Dictionaries())
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", conf.Storage)
+	}
+}
+
+// NewClassifier creates the question classifier selected by conf.Classifier.
+func NewClassifier(conf Config) (storage.Classifier, error) {
+	switch conf.Classifier {
+	case "", ClassifierDefault:
+		return storage.DefaultClassifier, nil
+	case ClassifierRules:
+		return storage.NewRuleClassifier(conf.ClassifierRules, storage.DefaultClassifier)
+	default:
+		return nil, fmt.Errorf("unknown classifier: %s", conf.Classifier)
+	}
+}
+
+func (conf Config) storePath() string {
+	if len(conf.StoreFile) > 0 {
+		return conf.StoreFile
+	}
+
+	if conf.Storage == StorageBolt {
+		return conf.Project + ".bolt"
+	}
+
+	return conf.Project + ".gob"
+}
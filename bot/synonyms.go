@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+)
+
+var aliasSeparator = regexp.MustCompile(`[,，|｜\r\n]+`)
+
+// Synonym is a term of the project with its aliases, such as the
+// abbreviations and the jargon of the teams, separated by commas, vertical
+// bars or new lines.
+type Synonym struct {
+	Id        int       `json:"id" form:"id" xorm:"int pk autoincr notnull 'id' comment('编号')"`
+	Project   string    `json:"project" form:"project" xorm:"varchar(255) notnull 'project' comment('项目')"`
+	Term      string    `json:"term" form:"term" xorm:"varchar(255) notnull 'term' comment('词语')"`
+	Aliases   string    `json:"aliases" form:"aliases" xorm:"text notnull 'aliases' comment('同义词')"`
+	CreatedAt time.Time `json:"created_at" xorm:"created_at created" description:"创建时间"`
+	UpdatedAt time.Time `json:"updated_at" xorm:"updated_at updated" description:"更新时间"`
+}
+
+// SplitAliases splits the aliases of a synonym.
+func SplitAliases(text string) []string {
+	var aliases []string
+	for _, alias := range aliasSeparator.Split(text, -1) {
+		if alias = strings.TrimSpace(alias); len(alias) > 0 {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases
+}
+
+// ListSynonyms lists the synonyms of the project.
+func (chatbot *ChatBot) ListSynonyms() ([]Synonym, error) {
+	var synonyms []Synonym
+	err := engine.Where("project = ?", chatbot.Config.Project).OrderBy("term").Find(&synonyms)
+	return synonyms, err
+}
+
+// LoadSynonymsFromDB loads the aliases of the terms of the project, the
+// aliases of the same term in different rows are merged.
+func (chatbot *ChatBot) LoadSynonymsFromDB() (map[string][]string, error) {
+	rows, err := chatbot.ListSynonyms()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]string)
+	for _, row := range rows {
+		term := strings.ToLower(strings.TrimSpace(row.Term))
+		if len(term) == 0 {
+			continue
+		}
+
+		groups[term] = append(groups[term], SplitAliases(row.Aliases)...)
+	}
+
+	return groups, nil
+}
+
+// RefreshSynonyms reloads the synonyms from the database and reindexes the
+// storage with them if they have changed.
+func (chatbot *ChatBot) RefreshSynonyms() error {
+	adapter, ok := chatbot.StorageAdapter.(storage.SynonymAdapter)
+	if !ok {
+		return nil
+	}
+
+	groups, err := chatbot.LoadSynonymsFromDB()
+	if err != nil {
+		return err
+	}
+
+	chatbot.synonymLock.Lock()
+	defer chatbot.synonymLock.Unlock()
+
+	// no need to reindex the storage if there have never been any synonyms
+	if len(chatbot.synonyms) == 0 && len(groups) == 0 || reflect.DeepEqual(chatbot.synonyms, groups) {
+		chatbot.synonyms = groups
+		return nil
+	}
+
+	adapter.SetSynonyms(storage.NewSynonyms(groups))
+	chatbot.synonyms = groups
+	return nil
+}
+
+// AddSynonymToDB adds the synonym to the project, or updates it if it has an
+// id, then the synonyms are applied.
+func (chatbot *ChatBot) AddSynonymToDB(synonym *Synonym) error {
+	synonym.Project = chatbot.Config.Project
+	synonym.Term = strings.TrimSpace(synonym.Term)
+	if len(synonym.Term) == 0 {
+		return errors.New("term must be set value")
+	}
+
+	var err error
+	if synonym.Id > 0 {
+		_, err = engine.Where("id = ? and project = ?", synonym.Id, synonym.Project).
+			Cols("term", "aliases").Update(synonym)
+	} else {
+		_, err = engine.Insert(synonym)
+	}
+	if err != nil {
+		return err
+	}
+
+	return chatbot.RefreshSynonyms()
+}
+
+// RemoveSynonymFromDB removes the synonym of the given id from the project,
+// then the synonyms are applied.
+func (chatbot *ChatBot) RemoveSynonymFromDB(id int) error {
+	if id <= 0 {
+		return errors.New("id must be set value")
+	}
+
+	if _, err := engine.Where("id = ? and project = ?", id, chatbot.Config.Project).Delete(&Synonym{}); err != nil {
+		return err
+	}
+
+	return chatbot.RefreshSynonyms()
+}
@@ -13,6 +13,7 @@ type (
 	Trainer interface {
 		Train(interface{}) error
 		TrainWithCorpus(corpuses map[string][][]string) error
+		TrainWithResponses(responses map[string][]storage.Response) error
 	}
 
 	ConversationTrainer struct {
@@ -30,11 +31,11 @@ func NewConversationTrainer(storage storage.StorageAdapter) *ConversationTrainer
 	}
 }
 
-func (trainer *ConversationTrainer) getOrCreate(text string) map[string]int {
+func (trainer *ConversationTrainer) getOrCreate(text string) []storage.Response {
 	if value, ok := trainer.storage.Find(text); ok {
 		return value
 	} else {
-		return make(map[string]int)
+		return nil
 	}
 }
 
@@ -56,8 +57,10 @@ func (trainer *ConversationTrainer) Train(data interface{}) error {
 		}
 
 		if len(history) > 0 {
-			responses := trainer.getOrCreate(history)
-			responses[sentence] += 1
+			responses := storage.AddResponse(trainer.getOrCreate(history), storage.Response{
+				Answer:     sentence,
+				Occurrence: 1,
+			})
 			trainer.storage.Update(history, responses)
 		}
 
@@ -82,7 +85,15 @@ func (trainer *CorpusTrainer) TrainWithCorpus(corpuses map[string][][]string) er
 			convTrainer.Train(conv)
 		}
 	}
-	trainer.storage.BuildIndex()
+	trainer.storage.Compact()
+	return nil
+}
+
+// TrainWithResponses replaces the responses of the questions with the given
+// ones, which is how the database corpora are trained.
+func (trainer *CorpusTrainer) TrainWithResponses(responses map[string][]storage.Response) error {
+	storage.UpdateAll(trainer.storage, responses)
+	trainer.storage.Compact()
 	return nil
 }
 
@@ -0,0 +1,309 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+	"github.com/kevwan/chatbot/bot/nlp"
+	"github.com/kevwan/chatbot/logger"
+)
+
+const (
+	// clusterThreshold is the least similarity of a question to the most asked
+	// question of its cluster
+	clusterThreshold = 0.6
+	// maxMinedFeedback is the most feedback to mine, the latest first
+	maxMinedFeedback = 5000
+	// maxClusters is the most clusters to keep, the most asked first
+	maxClusters = 100
+	// miningInterval is the interval to mine the unanswered questions
+	miningInterval = 10 * time.Minute
+)
+
+type (
+	// UnansweredCluster is the similar questions that are not answered, or
+	// answered but rejected by the users. Question is the most asked of the
+	// Questions, and Count is the times they are asked. Proposal is the corpus
+	// nearest to the questions, if any.
+	UnansweredCluster struct {
+		Question   string           `json:"question"`
+		Questions  []string         `json:"questions"`
+		Count      int              `json:"count"`
+		Unanswered int              `json:"unanswered"`
+		Rejected   int              `json:"rejected"`
+		Proposal   *ClusterProposal `json:"proposal,omitempty"`
+	}
+
+	// ClusterProposal is the corpus nearest to the questions of a cluster,
+	// which the questions may be added to as aliases.
+	ClusterProposal struct {
+		CorpusId   int     `json:"corpus_id"`
+		Question   string  `json:"question"`
+		Answer     string  `json:"answer"`
+		Confidence float32 `json:"confidence"`
+	}
+
+	// ClusterResolution answers the questions of a cluster in one step, by
+	// adding them to the corpus of CorpusId as aliases, or as a new corpus
+	// with Answer if CorpusId is 0.
+	ClusterResolution struct {
+		Project   string   `json:"project"`
+		Questions []string `json:"questions"`
+		CorpusId  int      `json:"corpus_id"`
+		Answer    string   `json:"answer"`
+		Class     string   `json:"class"`
+	}
+
+	minedQuestion struct {
+		question   string
+		unanswered int
+		rejected   int
+		// the corpora whose answers are rejected
+		rejectedIds map[int]bool
+	}
+)
+
+// UnansweredClusters returns the clusters of the unanswered questions mined
+// last, or mines them if never.
+func (chatbot *ChatBot) UnansweredClusters() ([]UnansweredCluster, error) {
+	chatbot.clusterLock.Lock()
+	clusters := chatbot.clusters
+	chatbot.clusterLock.Unlock()
+	if clusters != nil {
+		return clusters, nil
+	}
+
+	return chatbot.MineUnanswered()
+}
+
+// MineUnanswered clusters the unanswered and the rejected questions of the
+// project by similarity, the most asked clusters first, and proposes the
+// nearest corpus of each cluster.
+func (chatbot *ChatBot) MineUnanswered() ([]UnansweredCluster, error) {
+	var rows []Feedback
+	if err := engine.Where("project = ? and resolved = 0 and (cid = 0 or reject_count > accept_count)",
+		chatbot.Config.Project).Desc("id").Limit(maxMinedFeedback).Find(&rows); err != nil {
+		return nil, err
+	}
+
+	mined := make(map[string]*minedQuestion)
+	for _, row := range rows {
+		question := strings.TrimSpace(row.Question)
+		if len(question) == 0 {
+			continue
+		}
+
+		each, ok := mined[question]
+		if !ok {
+			each = &minedQuestion{
+				question:    question,
+				rejectedIds: make(map[int]bool),
+			}
+			mined[question] = each
+		}
+		if row.Cid == 0 {
+			each.unanswered++
+		} else {
+			each.rejected++
+			each.rejectedIds[row.Cid] = true
+		}
+	}
+
+	// the most asked questions lead the clusters
+	questions := make([]*minedQuestion, 0, len(mined))
+	for _, each := range mined {
+		questions = append(questions, each)
+	}
+	sort.Slice(questions, func(i, j int) bool {
+		ci := questions[i].unanswered + questions[i].rejected
+		cj := questions[j].unanswered + questions[j].rejected
+		if ci != cj {
+			return ci > cj
+		}
+		return questions[i].question < questions[j].question
+	})
+	texts := make([]string, len(questions))
+	for i, each := range questions {
+		texts[i] = strings.ToLower(each.question)
+	}
+
+	type minedCluster struct {
+		UnansweredCluster
+		rejectedIds map[int]bool
+	}
+	var mineds []minedCluster
+	for _, indexes := range nlp.Cluster(texts, clusterThreshold) {
+		cluster := minedCluster{
+			UnansweredCluster: UnansweredCluster{
+				Question: questions[indexes[0]].question,
+			},
+			rejectedIds: make(map[int]bool),
+		}
+		for _, index := range indexes {
+			each := questions[index]
+			cluster.Questions = append(cluster.Questions, each.question)
+			cluster.Unanswered += each.unanswered
+			cluster.Rejected += each.rejected
+			for id := range each.rejectedIds {
+				cluster.rejectedIds[id] = true
+			}
+		}
+		cluster.Count = cluster.Unanswered + cluster.Rejected
+		mineds = append(mineds, cluster)
+	}
+	sort.SliceStable(mineds, func(i, j int) bool {
+		return mineds[i].Count > mineds[j].Count
+	})
+	if len(mineds) > maxClusters {
+		mineds = mineds[:maxClusters]
+	}
+
+	// only the clusters kept are matched for the proposals, which is costly
+	clusters := make([]UnansweredCluster, 0, len(mineds))
+	for _, cluster := range mineds {
+		cluster.Proposal = chatbot.propose(cluster.Question, cluster.rejectedIds)
+		clusters = append(clusters, cluster.UnansweredCluster)
+	}
+
+	chatbot.clusterLock.Lock()
+	chatbot.clusters = clusters
+	chatbot.clusterLock.Unlock()
+
+	return clusters, nil
+}
+
+// ResolveUnanswered adds the questions to the corpus of the resolution as
+// aliases, or as a new corpus, and the questions are not mined any more.
+func (chatbot *ChatBot) ResolveUnanswered(resolution ClusterResolution) (*Corpus, error) {
+	var questions []string
+	for _, question := range resolution.Questions {
+		if question = strings.TrimSpace(question); len(question) > 0 {
+			questions = append(questions, question)
+		}
+	}
+	if len(questions) == 0 {
+		return nil, errors.New("questions must be set value")
+	}
+
+	var corpus *Corpus
+	var err error
+	if resolution.CorpusId > 0 {
+		corpus, err = chatbot.addAliases(resolution.CorpusId, questions)
+	} else {
+		corpus, err = chatbot.addAnswer(resolution, questions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = engine.Where("project = ?", chatbot.Config.Project).In("question", questions).
+		Cols("resolved").Update(&Feedback{Resolved: 1}); err != nil {
+		return nil, err
+	}
+
+	_, err = chatbot.MineUnanswered()
+	return corpus, err
+}
+
+// addAliases adds the questions to the corpus of the id, and to the storage.
+func (chatbot *ChatBot) addAliases(id int, questions []string) (*Corpus, error) {
+	corpus := Corpus{
+		Id: id,
+	}
+	if ok, err := engine.Get(&corpus); err != nil {
+		return nil, err
+	} else if !ok || corpus.Project != chatbot.Config.Project {
+		return nil, fmt.Errorf("corpus %d not found", id)
+	}
+
+	existing := make(map[string]bool)
+	aliases := SplitQuestions(corpus.Question)
+	for _, question := range aliases {
+		existing[question] = true
+	}
+	var added []string
+	for _, question := range SplitQuestions(strings.ToLower(strings.Join(questions, "\n"))) {
+		if !existing[question] {
+			existing[question] = true
+			added = append(added, question)
+		}
+	}
+	if len(added) == 0 {
+		return &corpus, nil
+	}
+
+	corpus.Question = strings.Join(append(aliases, added...), "\n")
+	if _, err := engine.Id(id).Cols("question").Update(&corpus); err != nil {
+		return nil, err
+	}
+	chatbot.updateStorage(added, corpus.Response())
+
+	return &corpus, nil
+}
+
+// addAnswer adds the questions with the answer as a new corpus, and to the
+// storage.
+func (chatbot *ChatBot) addAnswer(resolution ClusterResolution, questions []string) (*Corpus, error) {
+	if len(strings.TrimSpace(resolution.Answer)) == 0 {
+		return nil, errors.New("answer must be set value")
+	}
+
+	corpus := Corpus{
+		Class:    resolution.Class,
+		Project:  chatbot.Config.Project,
+		Question: strings.ToLower(strings.Join(questions, "\n")),
+		Answer:   resolution.Answer,
+		Qtype:    CORPUS_CORPUS.Int(),
+	}
+	if err := chatbot.AddCorpusToDB(&corpus); err != nil {
+		return nil, err
+	}
+	chatbot.updateStorage(SplitQuestions(corpus.Question), corpus.Response())
+
+	return &corpus, nil
+}
+
+// propose returns the corpus nearest to the question, except the rejected.
+func (chatbot *ChatBot) propose(question string, rejectedIds map[int]bool) *ClusterProposal {
+	if chatbot.LogicAdapter == nil || !chatbot.LogicAdapter.CanProcess(question) {
+		return nil
+	}
+
+	for _, answer := range logic.ProcessWithHistory(chatbot.LogicAdapter, question, nil) {
+		if answer.CorpusId <= 0 || rejectedIds[answer.CorpusId] {
+			continue
+		}
+
+		return &ClusterProposal{
+			CorpusId:   answer.CorpusId,
+			Question:   answer.Question,
+			Answer:     answer.Content,
+			Confidence: answer.Confidence,
+		}
+	}
+
+	return nil
+}
+
+func (chatbot *ChatBot) updateStorage(questions []string, response storage.Response) {
+	for _, question := range questions {
+		responses, _ := chatbot.StorageAdapter.Find(question)
+		chatbot.StorageAdapter.Update(question, storage.AddResponse(responses, response))
+	}
+}
+
+// mineUnanswered mines the unanswered questions periodically.
+func (chatbot *ChatBot) mineUnanswered() {
+	for {
+		if _, err := chatbot.MineUnanswered(); err != nil {
+			logger.Errorf("project %s: %v", chatbot.Config.Project, err)
+		}
+
+		time.Sleep(miningInterval)
+	}
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xorm/xorm"
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+)
+
+// countingMatch answers every question with the corpus 1, and counts the
+// questions processed.
+type countingMatch struct {
+	processed int
+}
+
+func (match *countingMatch) CanProcess(string) bool {
+	return true
+}
+
+func (match *countingMatch) Process(text string) []logic.Answer {
+	match.processed++
+	return []logic.Answer{{CorpusId: 1, Question: "question", Content: "answer", Confidence: 0.5}}
+}
+
+func (match *countingMatch) SetVerbose() {
+}
+
+// useTestEngine points the database engine to an empty sqlite database.
+func useTestEngine(t *testing.T) {
+	db, err := xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "chatbot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Sync2(&Corpus{}, &Feedback{}); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := engine
+	engine = db
+	t.Cleanup(func() {
+		engine = previous
+		db.Close()
+	})
+}
+
+func TestMineUnansweredProposesKeptClusters(t *testing.T) {
+	useTestEngine(t)
+	// the questions of different characters, each a cluster, the later asked more
+	for i := 0; i < maxClusters+20; i++ {
+		question := string([]rune{rune(0x4e00 + i*3), rune(0x4e01 + i*3), rune(0x4e02 + i*3)})
+		for j := 0; j <= i/50; j++ {
+			if _, err := engine.Insert(&Feedback{Project: "test", Question: question}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	match := new(countingMatch)
+	chatbot := &ChatBot{
+		LogicAdapter: match,
+		Config:       Config{Project: "test"},
+	}
+	clusters, err := chatbot.MineUnanswered()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(clusters) != maxClusters || match.processed != maxClusters {
+		t.Fatalf("expected %d clusters proposed for, got %d clusters and %d proposed",
+			maxClusters, len(clusters), match.processed)
+	}
+	if clusters[0].Count != 3 || clusters[len(clusters)-1].Count != 1 {
+		t.Fatalf("expected the most asked clusters kept, got %d to %d",
+			clusters[0].Count, clusters[len(clusters)-1].Count)
+	}
+	for _, cluster := range clusters {
+		if cluster.Proposal == nil || cluster.Proposal.CorpusId != 1 {
+			t.Fatalf("expected the proposal of each cluster kept, got %+v", cluster)
+		}
+	}
+}
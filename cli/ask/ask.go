@@ -11,29 +11,54 @@ import (
 	"github.com/kevwan/chatbot/bot"
 	"github.com/kevwan/chatbot/bot/adapters/logic"
 	"github.com/kevwan/chatbot/bot/adapters/storage"
+	"github.com/kevwan/chatbot/bot/rich"
 )
 
+const askSession = "ask"
+
 var (
-	verbose   = flag.Bool("v", false, "verbose mode")
+	verbose   = flag.Bool("v", false, "verbose mode, explains how the questions are answered")
 	storeFile = flag.String("c", "corpus.gob", "the file to store corpora")
 	tops      = flag.Int("t", 5, "the number of answers to return")
+	ranking   = flag.String("r", "similarity", "the ranking of candidates: similarity, bm25 or blend")
+	matching  = flag.String("l", "closest", "the comma separated logic adapters: exact, closest or semantic")
+	minScore  = flag.Float64("min", 0, "the minimum confidence of answers")
+	suggest   = flag.Float64("suggest", 0, "the minimum confidence of suggestions, below -min")
+	strategy  = flag.String("s", "fallback", "the strategy to combine logic adapters: fallback, first, merge or vote")
 )
 
 func main() {
 	flag.Parse()
 
-	store, err := storage.NewSeparatedMemoryStorage(*storeFile)
+	store, err := storage.NewSeparatedMemoryStorage(*storeFile, "")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	chatbot := &bot.ChatBot{
-		LogicAdapter: logic.NewClosestMatch(store, *tops),
+	conf := bot.Config{
+		StoreFile:         *storeFile,
+		Ranking:           *ranking,
+		Logic:             *matching,
+		MinConfidence:     float32(*minScore),
+		SuggestConfidence: float32(*suggest),
+		ComboStrategy:     *strategy,
 	}
-	if *verbose {
-		chatbot.LogicAdapter.SetVerbose()
+	logicAdapter, err := bot.NewLogicAdapter(conf, store, *tops)
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	sessions, err := bot.NewSessionStore(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	chatbot := &bot.ChatBot{
+		LogicAdapter:   logicAdapter,
+		StorageAdapter: store,
+		Sessions:       sessions,
+		Config:         conf,
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
 		fmt.Print("Q: ")
@@ -44,24 +69,94 @@ func main() {
 		}
 
 		startTime := time.Now()
-		answers := chatbot.GetResponse(question)
+		// the questions in a run are one conversation
+		var response bot.Response
+		if *verbose {
+			response = chatbot.ConverseWithTrace(askSession, question, nil)
+			printTrace(response.Trace)
+		} else {
+			response = chatbot.Converse(askSession, question, nil)
+		}
+		if len(response.DidYouMean) > 0 {
+			fmt.Printf("(%s)\n", response.DidYouMean)
+		}
+		answers := response.Answers
 		if len(answers) == 0 {
-			fmt.Println("No answer!")
-			continue
+			if len(response.Suggestions) == 0 {
+				fmt.Println("No answer!")
+				continue
+			}
+
+			fmt.Println("Did you mean:")
+			answers = response.Suggestions
 		}
 
 		if *tops == 1 {
 			fmt.Printf("A: %s\n", answers[0].Content)
+			printBlocks(answers[0])
 			continue
 		}
 
 		for i, answer := range answers {
 			fmt.Printf("%d: %s\n", i+1, answer.Content)
+			printBlocks(answer)
 			if *verbose {
-				fmt.Printf("%d: %s\tConfidence: %.3f\t%s\n", i+1, answer.Content,
-					answer.Confidence, time.Since(startTime))
+				fmt.Printf("%d: %s\tConfidence: %.3f\tAdapter: %s\t%s\n", i+1, answer.Content,
+					answer.Confidence, answer.Adapter, time.Since(startTime))
 			}
 		}
 		fmt.Println(time.Since(startTime))
 	}
 }
+
+// printBlocks prints the rich content of the answer as plain text, the buttons
+// are the questions to ask next.
+func printBlocks(answer logic.Answer) {
+	if len(answer.Blocks) == 0 {
+		return
+	}
+
+	fmt.Println(rich.Plain(answer.Blocks))
+}
+
+// printTrace prints how the question is searched, scored and answered.
+func printTrace(trace *logic.Trace) {
+	if trace == nil {
+		return
+	}
+
+	if search := trace.Search; search != nil {
+		if len(search.Store) > 0 {
+			fmt.Printf("Store: %s\n", search.Store)
+		}
+		fmt.Printf("Keywords: %v\n", search.Keywords)
+		if len(search.Postings) > 0 {
+			fmt.Printf("Postings: %v\n", search.Postings)
+		}
+		for _, correction := range search.Corrections {
+			fmt.Printf("Corrected: %s -> %s\n", correction.Term, correction.Correction)
+		}
+		fmt.Printf("Candidates found: %d\n", len(search.Candidates))
+	}
+
+	for _, candidate := range trace.Candidates {
+		fmt.Printf("  #%d %.3f %s", candidate.Rank, candidate.Score, candidate.Question)
+		if len(candidate.Scores) > 0 {
+			fmt.Printf("\t%v", candidate.Scores)
+		}
+		fmt.Println()
+	}
+
+	for _, step := range trace.Steps {
+		fmt.Printf("Step %s: %d answers", step.Adapter, len(step.Answers))
+		if len(step.Note) > 0 {
+			fmt.Printf(", %s", step.Note)
+		}
+		fmt.Println()
+		for _, answer := range step.Answers {
+			fmt.Printf("  %.3f %s\n", answer.Confidence, answer.Question)
+		}
+	}
+
+	fmt.Printf("Reason: %s\n", trace.Reason)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevwan/chatbot/bot"
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+)
+
+var (
+	storeFile = flag.String("c", "corpus.gob", "the store file to evaluate")
+	casesFile = flag.String("i", "", "the test set, a JSON line of question, expected corpus id and optional class each")
+	output    = flag.String("o", "", "the file to write the JSON report, - for stdout")
+	compare   = flag.String("compare", "", "the JSON report of another store build to compare with")
+	tops      = flag.Int("t", 5, "the number of answers to evaluate, the k of top-k")
+	ranking   = flag.String("r", "similarity", "the ranking of candidates: similarity, bm25 or blend")
+	matching  = flag.String("l", "closest", "the comma separated logic adapters: exact, closest or semantic")
+	minScore  = flag.Float64("min", 0, "the minimum confidence of answers")
+	strategy  = flag.String("s", "fallback", "the strategy to combine logic adapters: fallback, first, merge or vote")
+	sweep     = flag.String("sweep", "", "the comma separated minimum confidences to evaluate the answers at, like 0.2,0.4,0.6")
+)
+
+func main() {
+	flag.Parse()
+
+	if len(*casesFile) == 0 {
+		flag.Usage()
+		return
+	}
+
+	cases, err := loadCases(*casesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	thresholds, err := parseThresholds(*sweep)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := storage.NewSeparatedMemoryStorage(*storeFile, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	conf := bot.Config{
+		StoreFile:     *storeFile,
+		Ranking:       *ranking,
+		Logic:         *matching,
+		MinConfidence: float32(*minScore),
+		ComboStrategy: *strategy,
+	}
+	chatbot, err := newChatBot(conf, store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cases = classify(cases, store)
+	report := newReport(*storeFile, *tops, evaluate(chatbot, cases))
+	if len(thresholds) > 0 {
+		report.Sweep, err = sweepThresholds(cases, thresholds, func(threshold float64) (*bot.ChatBot, error) {
+			conf.MinConfidence = float32(threshold)
+			return newChatBot(conf, store)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	switch *output {
+	case "":
+		printReport(report)
+	case "-":
+		if err := writeReport(os.Stdout, report); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = writeReport(f, report)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		printReport(report)
+	}
+
+	if len(*compare) > 0 {
+		base, err := readReport(*compare)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printComparison(base, report)
+	}
+}
+
+func newChatBot(conf bot.Config, store storage.StorageAdapter) (*bot.ChatBot, error) {
+	logicAdapter, err := bot.NewLogicAdapter(conf, store, *tops)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bot.ChatBot{
+		LogicAdapter:   logicAdapter,
+		StorageAdapter: store,
+		Config:         conf,
+	}, nil
+}
+
+// evaluate asks the questions of the cases one by one, without history.
+func evaluate(chatbot *bot.ChatBot, cases []Case) []Result {
+	results := make([]Result, 0, len(cases))
+	for _, each := range cases {
+		startTime := time.Now()
+		response := chatbot.RespondWithHistory(each.Question, nil, nil)
+		latency := time.Since(startTime)
+
+		answers := make([]int, 0, len(response.Answers))
+		for _, answer := range response.Answers {
+			answers = append(answers, answer.CorpusId)
+		}
+		results = append(results, Result{
+			Case:    each,
+			Answers: answers,
+			Latency: latency,
+		})
+	}
+
+	return results
+}
+
+// sweepThresholds evaluates the cases at each of the minimum confidences, by
+// the chatbot that newChatBot creates with the threshold, so that the logic
+// adapters fall back the same way as they would with the threshold configured.
+func sweepThresholds(cases []Case, thresholds []float64,
+	newChatBot func(threshold float64) (*bot.ChatBot, error)) ([]SweepPoint, error) {
+	points := make([]SweepPoint, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		chatbot, err := newChatBot(threshold)
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, newSweepPoint(threshold, evaluate(chatbot, cases)))
+	}
+
+	return points, nil
+}
+
+// classify sets the classes of the cases without one to the classes of their
+// expected corpora in the store.
+func classify(cases []Case, store storage.StorageAdapter) []Case {
+	var classes map[int]string
+	for i := range cases {
+		if len(cases[i].Class) > 0 {
+			continue
+		}
+		if cases[i].Id == 0 {
+			cases[i].Class = noAnswerClass
+			continue
+		}
+
+		if classes == nil {
+			classes = make(map[int]string)
+			for _, key := range store.Keys() {
+				responses, _ := store.Find(key)
+				for _, response := range responses {
+					if response.CorpusId > 0 && len(response.Class) > 0 {
+						classes[response.CorpusId] = response.Class
+					}
+				}
+			}
+		}
+		cases[i].Class = classes[cases[i].Id]
+	}
+
+	return cases
+}
+
+func loadCases(file string) ([]Case, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []Case
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var each Case
+		if err := json.Unmarshal([]byte(text), &each); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, line, err)
+		}
+		if len(each.Question) == 0 {
+			return nil, fmt.Errorf("%s:%d: no question", file, line)
+		}
+		cases = append(cases, each)
+	}
+
+	return cases, scanner.Err()
+}
+
+// parseThresholds parses the comma separated minimum confidences to sweep, in
+// ascending order.
+func parseThresholds(value string) ([]float64, error) {
+	var thresholds []float64
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+
+		threshold, err := strconv.ParseFloat(field, 64)
+		if err != nil || threshold < 0 || threshold > 1 {
+			return nil, fmt.Errorf("bad minimum confidence to sweep: %s", field)
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	sort.Float64s(thresholds)
+
+	return thresholds, nil
+}
+
+func readReport(file string) (Report, error) {
+	var report Report
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return report, err
+	}
+
+	err = json.Unmarshal(content, &report)
+	return report, err
+}
+
+func writeReport(f *os.File, report Report) error {
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(report)
+}
+
+func printReport(report Report) {
+	fmt.Printf("Store: %s\n", report.Store)
+	printMetrics("all", report.Tops, report.Metrics)
+	for _, class := range report.Classes {
+		printMetrics(class.Class, report.Tops, class.Metrics)
+	}
+	fmt.Printf("Latency: p50 %.2fms, p90 %.2fms, p99 %.2fms, max %.2fms\n",
+		report.Latency.P50, report.Latency.P90, report.Latency.P99, report.Latency.Max)
+	fmt.Printf("Misses: %d\n", len(report.Misses))
+	for _, point := range report.Sweep {
+		printMetrics(fmt.Sprintf("min %.2f", point.Threshold), report.Tops, point.Metrics)
+	}
+}
+
+func printMetrics(class string, tops int, metrics Metrics) {
+	if len(class) == 0 {
+		class = "(unclassified)"
+	}
+	fmt.Printf("%s: %d questions, top-1 %.3f, top-%d %.3f, MRR %.3f, no answer %.3f\n", class,
+		metrics.Total, metrics.Top1, tops, metrics.TopK, metrics.MRR, metrics.NoAnswerRate)
+}
+
+// printComparison prints the changes of the metrics from the base report.
+func printComparison(base, report Report) {
+	fmt.Printf("Compared with %s:\n", base.Store)
+	printChanges("all", base.Metrics, report.Metrics)
+
+	classes := make(map[string]Metrics)
+	for _, class := range base.Classes {
+		classes[class.Class] = class.Metrics
+	}
+	for _, class := range report.Classes {
+		printChanges(class.Class, classes[class.Class], class.Metrics)
+		delete(classes, class.Class)
+	}
+	for _, class := range base.Classes {
+		if metrics, ok := classes[class.Class]; ok {
+			printChanges(class.Class, metrics, Metrics{})
+		}
+	}
+}
+
+func printChanges(class string, base, metrics Metrics) {
+	if len(class) == 0 {
+		class = "(unclassified)"
+	}
+	fmt.Printf("%s: %d -> %d questions, top-1 %+.3f, top-k %+.3f, MRR %+.3f, no answer %+.3f\n",
+		class, base.Total, metrics.Total, metrics.Top1-base.Top1, metrics.TopK-base.TopK,
+		metrics.MRR-base.MRR, metrics.NoAnswerRate-base.NoAnswerRate)
+}
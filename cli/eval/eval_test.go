@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kevwan/chatbot/bot"
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+)
+
+// stubMatch answers the questions with their fixed answers.
+type stubMatch map[string][]logic.Answer
+
+func (match stubMatch) CanProcess(string) bool {
+	return true
+}
+
+func (match stubMatch) Process(text string) []logic.Answer {
+	return append([]logic.Answer(nil), match[text]...)
+}
+
+func (match stubMatch) SetVerbose() {
+}
+
+func TestSweepThresholds(t *testing.T) {
+	match := stubMatch{
+		"q1": {{CorpusId: 1, Confidence: 0.9}},
+		"q2": {{CorpusId: 3, Confidence: 0.5}, {CorpusId: 2, Confidence: 0.4}},
+		"q3": {{CorpusId: 1, Confidence: 0.3}},
+	}
+	cases := []Case{
+		{Question: "q1", Id: 1},
+		{Question: "q2", Id: 2},
+		{Question: "q3"},
+	}
+
+	points, err := sweepThresholds(cases, []float64{0, 0.45, 0.6}, func(threshold float64) (*bot.ChatBot, error) {
+		return &bot.ChatBot{
+			LogicAdapter: match,
+			Config:       bot.Config{MinConfidence: float32(threshold)},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(points) != 3 {
+		t.Fatalf("expected a point for each threshold, got %v", points)
+	}
+	expects := []SweepPoint{
+		{Threshold: 0, Metrics: Metrics{Total: 3, Top1: 1.0 / 3, TopK: 2.0 / 3, MRR: 1.5 / 3}},
+		{Threshold: 0.45, Metrics: Metrics{Total: 3, Top1: 2.0 / 3, TopK: 2.0 / 3, MRR: 2.0 / 3,
+			NoAnswerRate: 1.0 / 3}},
+		{Threshold: 0.6, Metrics: Metrics{Total: 3, Top1: 2.0 / 3, TopK: 2.0 / 3, MRR: 2.0 / 3,
+			NoAnswerRate: 2.0 / 3}},
+	}
+	for i, point := range points {
+		if point.Threshold != expects[i].Threshold {
+			t.Fatalf("expected the threshold %v, got %v", expects[i].Threshold, point.Threshold)
+		}
+		assertMetrics(t, "sweep", point.Metrics, expects[i].Metrics)
+	}
+}
+
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := parseThresholds("0.6, 0.2,,0.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(thresholds, []float64{0.2, 0.4, 0.6}) {
+		t.Fatalf("expected the thresholds in order, got %v", thresholds)
+	}
+	if thresholds, err := parseThresholds(""); err != nil || thresholds != nil {
+		t.Fatalf("expected no thresholds, got %v %v", thresholds, err)
+	}
+	if _, err := parseThresholds("0.2,high"); err == nil {
+		t.Fatal("expected the bad threshold to fail")
+	}
+	if _, err := parseThresholds("1.5"); err == nil {
+		t.Fatal("expected the threshold out of range to fail")
+	}
+}
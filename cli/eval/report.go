@@ -0,0 +1,208 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// noAnswerClass is the class of the questions expected to have no answer.
+const noAnswerClass = "no answer"
+
+type (
+	// Case is a labelled question of the test set, Id is the expected corpus id,
+	// 0 if the question is expected to have no answer. Class defaults to the class
+	// of the expected corpus.
+	Case struct {
+		Question string `json:"question"`
+		Id       int    `json:"id"`
+		Class    string `json:"class,omitempty"`
+	}
+
+	// Result is the answers of a case, the corpus ids of the answers in order.
+	Result struct {
+		Case
+		Answers []int         `json:"answers"`
+		Latency time.Duration `json:"-"`
+	}
+
+	// Metrics measures the answers of the cases. A case is answered correctly at
+	// rank n if the expected corpus is the nth answer, or at rank 1 if it expects
+	// and gets no answer.
+	Metrics struct {
+		Total        int     `json:"total"`
+		Top1         float64 `json:"top1"`
+		TopK         float64 `json:"topk"`
+		MRR          float64 `json:"mrr"`
+		NoAnswerRate float64 `json:"no_answer_rate"`
+	}
+
+	// ClassMetrics is the metrics of the cases of a class.
+	ClassMetrics struct {
+		Class string `json:"class"`
+		Metrics
+	}
+
+	// Latency is the percentiles of the latencies to answer, in milliseconds.
+	Latency struct {
+		P50 float64 `json:"p50_ms"`
+		P90 float64 `json:"p90_ms"`
+		P99 float64 `json:"p99_ms"`
+		Max float64 `json:"max_ms"`
+	}
+
+	// SweepPoint is the metrics of the cases answered at the minimum confidence
+	// Threshold.
+	SweepPoint struct {
+		Threshold float64 `json:"threshold"`
+		Metrics
+	}
+
+	// Report is the evaluation of a store, Misses are the cases not answered
+	// correctly at the top. Sweep is the metrics at other minimum confidences,
+	// if asked for. The report has no timestamps, so that the reports of two
+	// store builds can be diffed.
+	Report struct {
+		Store   string         `json:"store"`
+		Tops    int            `json:"tops"`
+		Metrics Metrics        `json:"metrics"`
+		Classes []ClassMetrics `json:"classes"`
+		Latency Latency        `json:"latency"`
+		Misses  []Result       `json:"misses"`
+		Sweep   []SweepPoint   `json:"sweep,omitempty"`
+	}
+
+	metricsCounter struct {
+		total     int
+		top1      int
+		topK      int
+		noAnswers int
+		rr        float64
+	}
+)
+
+// rank returns the rank of the expected answer of the result, 0 if not found.
+func (result Result) rank() int {
+	if result.Id == 0 {
+		if len(result.Answers) == 0 {
+			return 1
+		}
+		return 0
+	}
+
+	for i, id := range result.Answers {
+		if id == result.Id {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func newReport(store string, tops int, results []Result) Report {
+	report := Report{
+		Store:   store,
+		Tops:    tops,
+		Classes: make([]ClassMetrics, 0),
+		Misses:  make([]Result, 0),
+	}
+
+	var all metricsCounter
+	classes := make(map[string]*metricsCounter)
+	latencies := make([]time.Duration, 0, len(results))
+	for _, result := range results {
+		counter, ok := classes[result.Class]
+		if !ok {
+			counter = new(metricsCounter)
+			classes[result.Class] = counter
+		}
+
+		rank := result.rank()
+		all.add(rank, len(result.Answers) == 0)
+		counter.add(rank, len(result.Answers) == 0)
+		if rank != 1 {
+			report.Misses = append(report.Misses, result)
+		}
+		latencies = append(latencies, result.Latency)
+	}
+
+	report.Metrics = all.metrics()
+	for class, counter := range classes {
+		report.Classes = append(report.Classes, ClassMetrics{
+			Class:   class,
+			Metrics: counter.metrics(),
+		})
+	}
+	sort.Slice(report.Classes, func(i, j int) bool {
+		return report.Classes[i].Class < report.Classes[j].Class
+	})
+	report.Latency = newLatency(latencies)
+
+	return report
+}
+
+func newSweepPoint(threshold float64, results []Result) SweepPoint {
+	var counter metricsCounter
+	for _, result := range results {
+		counter.add(result.rank(), len(result.Answers) == 0)
+	}
+
+	return SweepPoint{
+		Threshold: threshold,
+		Metrics:   counter.metrics(),
+	}
+}
+
+func newLatency(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	// the nearest rank percentiles
+	percentile := func(p int) float64 {
+		rank := (p*len(latencies) + 99) / 100
+		return milliseconds(latencies[rank-1])
+	}
+
+	return Latency{
+		P50: percentile(50),
+		P90: percentile(90),
+		P99: percentile(99),
+		Max: milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+func (counter *metricsCounter) add(rank int, noAnswer bool) {
+	counter.total++
+	if rank == 1 {
+		counter.top1++
+	}
+	if rank > 0 {
+		counter.topK++
+		counter.rr += 1 / float64(rank)
+	}
+	if noAnswer {
+		counter.noAnswers++
+	}
+}
+
+func (counter *metricsCounter) metrics() Metrics {
+	if counter.total == 0 {
+		return Metrics{}
+	}
+
+	total := float64(counter.total)
+	return Metrics{
+		Total:        counter.total,
+		Top1:         float64(counter.top1) / total,
+		TopK:         float64(counter.topK) / total,
+		MRR:          counter.rr / total,
+		NoAnswerRate: float64(counter.noAnswers) / total,
+	}
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testResults are the answers of a fixed test set, two expected at the top,
+// one at the second, one at the third, one missed, one rightly unanswered and
+// one answered but expected to have no answer.
+var testResults = []Result{
+	{Case: Case{Question: "q1", Id: 1, Class: "a"}, Answers: []int{1, 2}},
+	{Case: Case{Question: "q2", Id: 2, Class: "a"}, Answers: []int{2}},
+	{Case: Case{Question: "q3", Id: 3, Class: "a"}, Answers: []int{1, 3}},
+	{Case: Case{Question: "q4", Id: 4, Class: "b"}, Answers: []int{1, 2, 4}},
+	{Case: Case{Question: "q5", Id: 5, Class: "b"}, Answers: []int{1, 2}},
+	{Case: Case{Question: "q6", Class: noAnswerClass}},
+	{Case: Case{Question: "q7", Class: noAnswerClass}, Answers: []int{1}},
+}
+
+func TestResultRank(t *testing.T) {
+	ranks := make([]int, 0, len(testResults))
+	for _, result := range testResults {
+		ranks = append(ranks, result.rank())
+	}
+	if !reflect.DeepEqual(ranks, []int{1, 1, 2, 3, 0, 1, 0}) {
+		t.Fatalf("unexpected ranks %v", ranks)
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	report := newReport("store.gob", 3, testResults)
+
+	assertMetrics(t, "all", report.Metrics, Metrics{
+		Total:        7,
+		Top1:         3.0 / 7,
+		TopK:         5.0 / 7,
+		MRR:          (1 + 1 + 0.5 + 1.0/3 + 1) / 7,
+		NoAnswerRate: 1.0 / 7,
+	})
+
+	classes := make([]string, 0, len(report.Classes))
+	for _, class := range report.Classes {
+		classes = append(classes, class.Class)
+	}
+	if !reflect.DeepEqual(classes, []string{"a", "b", noAnswerClass}) {
+		t.Fatalf("expected the classes in order, got %v", classes)
+	}
+	assertMetrics(t, "a", report.Classes[0].Metrics, Metrics{
+		Total: 3,
+		Top1:  2.0 / 3,
+		TopK:  1,
+		MRR:   2.5 / 3,
+	})
+	assertMetrics(t, "b", report.Classes[1].Metrics, Metrics{
+		Total: 2,
+		TopK:  0.5,
+		MRR:   1.0 / 6,
+	})
+	assertMetrics(t, noAnswerClass, report.Classes[2].Metrics, Metrics{
+		Total:        2,
+		Top1:         0.5,
+		TopK:         0.5,
+		MRR:          0.5,
+		NoAnswerRate: 0.5,
+	})
+
+	misses := make([]string, 0, len(report.Misses))
+	for _, miss := range report.Misses {
+		misses = append(misses, miss.Question)
+	}
+	if !reflect.DeepEqual(misses, []string{"q3", "q4", "q5", "q7"}) {
+		t.Fatalf("expected the cases not answered at the top missed, got %v", misses)
+	}
+}
+
+func TestNewReportEmpty(t *testing.T) {
+	report := newReport("store.gob", 3, nil)
+	if report.Metrics != (Metrics{}) || len(report.Classes) != 0 || report.Latency != (Latency{}) {
+		t.Fatalf("expected an empty report, got %+v", report)
+	}
+}
+
+func assertMetrics(t *testing.T, name string, metrics, expect Metrics) {
+	t.Helper()
+	values := []float64{metrics.Top1, metrics.TopK, metrics.MRR, metrics.NoAnswerRate}
+	expects := []float64{expect.Top1, expect.TopK, expect.MRR, expect.NoAnswerRate}
+	if metrics.Total != expect.Total {
+		t.Fatalf("%s: expected %d questions, got %d", name, expect.Total, metrics.Total)
+	}
+	for i := range values {
+		if math.Abs(values[i]-expects[i]) > 1e-9 {
+			t.Fatalf("%s: expected %+v, got %+v", name, expect, metrics)
+		}
+	}
+}
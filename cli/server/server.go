@@ -15,10 +15,20 @@ import (
 	"github.com/gobuffalo/packr"
 	"github.com/kevwan/chatbot/bot"
 	"github.com/kevwan/chatbot/bot/adapters/logic"
+	"github.com/kevwan/chatbot/bot/adapters/storage"
+	"github.com/kevwan/chatbot/bot/rich"
 	"github.com/prometheus/common/log"
+	"github.com/tal-tech/go-zero/core/stringx"
 )
 
-var factory *bot.ChatBotFactory
+// sessionHeader carries the session id of the conversation, a new session is
+// started if the request doesn't have one.
+const sessionHeader = "X-Session-Id"
+
+var (
+	factory *bot.ChatBotFactory
+	assets  *rich.AssetStore
+)
 
 var (
 	verbose = flag.Bool("v", false, "verbose mode")
@@ -33,6 +43,17 @@ var (
 	storeFile     = flag.String("o", "/Users/dev/repo/chatbot/corpus.gob", "the file to store corpora")
 	printMemStats = flag.Bool("m", false, "enable printing memory stats")
 	logPath       = flag.String("l", "./log", "log path")
+	assetDir      = flag.String("assets", "./assets", "the directory of the images in rich answers")
+)
+
+// assetPrefix is the path to serve the assets of the rich answers.
+const assetPrefix = "/assets"
+
+// The replies to the questions without answers if the project has no
+// default_reply, the long questions get recordedReply since they are logged.
+const (
+	noAnswerReply = "对不起，没有找答案,请详细描述你的问题（文字不少于15个汉字），\n我们会自动收集你的问题并进行反馈，谢谢！！"
+	recordedReply = "对不起，没有找答案,你的问题我已经记录并反馈，无需重复提交，谢谢！！！。"
 )
 
 type JsonResult struct {
@@ -42,15 +63,29 @@ type JsonResult struct {
 }
 
 type QA struct {
-	Question string  `json:"question"`
-	Answer   string  `json:"answer"`
-	Score    float32 `json:"score"`
-	ID       int     `json:"id"`
+	Question   string             `json:"question"`
+	Answer     string             `json:"answer"`
+	Score      float32            `json:"score"`
+	ID         int                `json:"id"`
+	Class      string             `json:"class"`
+	Project    string             `json:"project"`
+	Suggested  bool               `json:"suggested,omitempty"`
+	Adapter    string             `json:"adapter"`
+	Scores     map[string]float32 `json:"scores,omitempty"`
+	Blocks     []rich.Block       `json:"blocks,omitempty"`
+	DidYouMean string             `json:"did_you_mean,omitempty"`
 }
 
+// ResoveReq is the feedback on the answer of a corpus, Question is the
+// question asked, if given the answer to it is learned. Without Question, the
+// question is the last one of the session answered by the corpus, the session
+// is SessionId or the session header, and Project defaults to -project.
 type ResoveReq struct {
-	IsOk bool `json:"is_ok"`
-	Id   int  `json:"id"`
+	IsOk      bool   `json:"is_ok"`
+	Id        int    `json:"id"`
+	Question  string `json:"question"`
+	Project   string `json:"project"`
+	SessionId string `json:"session_id"`
 }
 
 type ruleDataReq struct {
@@ -111,12 +146,6 @@ type RuleResp struct {
 	Flag                bool                `json:"flag"`
 }
 
-func init() {
-
-	flag.Parse()
-
-}
-
 func HandlerResult(ctx *gin.Context, data *interface{}, err *error) {
 	message := "success"
 	if *err != nil {
@@ -141,16 +170,17 @@ func bindRounter(router *gin.Engine) {
 	buildAnswer := func(answers []logic.Answer) []QA {
 		var qas []QA
 		for _, answer := range answers {
-			contents := strings.Split(answer.Content, "$$$$")
-			if len(contents) > 2 {
-				qa := QA{
-					Question: contents[0],
-					Answer:   contents[1],
-					Score:    answer.Confidence,
-				}
-				qa.ID, _ = strconv.Atoi(contents[2])
-				qas = append(qas, qa)
-			}
+			qas = append(qas, QA{
+				Question: answer.Question,
+				Answer:   answer.Content,
+				Score:    answer.Confidence,
+				ID:       answer.CorpusId,
+				Class:    answer.Class,
+				Project:  answer.Project,
+				Adapter:  answer.Adapter,
+				Scores:   answer.Scores,
+				Blocks:   answer.Blocks,
+			})
 		}
 		return qas
 	}
@@ -185,23 +215,47 @@ func bindRounter(router *gin.Engine) {
 		if err != nil {
 			return
 		}
-		answer := make(map[string]int)
-		exp, err := regexp.Compile(`[|｜\r\n]+`)
+		if len(corpus.Slots) > 0 {
+			err = chatbot.RefreshIntents()
+			return
+		}
+		for _, question := range bot.SplitQuestions(corpus.Question) {
+			chatbot.StorageAdapter.Update(question, []storage.Response{corpus.Response()})
+		}
+	})
+
+	v1.POST("asset", func(context *gin.Context) {
+		var (
+			data interface{}
+			err  error
+		)
+		defer HandlerResult(context, &data, &err)
+		file, header, err := context.Request.FormFile("file")
 		if err != nil {
 			return
 		}
-		questions := exp.Split(corpus.Question, -1)
-		for _, question := range questions {
-			if strings.TrimSpace(question) == "" {
-				continue
-			}
-			if !strings.HasSuffix(question, "?") && !strings.HasSuffix(question, "？") {
-				question = question + "?"
-			}
-			answer[fmt.Sprintf("%s$$$$%s$$$$%v", question, corpus.Answer, corpus.Id)] = 1
-			chatbot.StorageAdapter.Update(question, answer)
+		defer file.Close()
+		data, err = assets.Save(header.Filename, file)
+	})
+
+	v1.POST("dictionary", func(context *gin.Context) {
+		var (
+			data interface{}
+			err  error
+		)
+		defer HandlerResult(context, &data, &err)
+		project := context.PostForm("project")
+		var chatbot *bot.ChatBot
+		if chatbot, _ = factory.GetChatBot(project); chatbot == nil {
+			err = fmt.Errorf("project '%s' not found", project)
+			return
+		}
+		file, _, err := context.Request.FormFile("file")
+		if err != nil {
+			return
 		}
-		chatbot.StorageAdapter.BuildIndex()
+		defer file.Close()
+		err = chatbot.SaveDictionary(context.PostForm("kind"), file)
 	})
 
 	v1.GET("search", func(context *gin.Context) {
@@ -236,33 +290,92 @@ func bindRounter(router *gin.Engine) {
 			if !strings.HasSuffix(q, "?") && !strings.HasSuffix(q, "？") {
 				q = q + "?"
 			}
-			results := chatbot.GetResponse(q)
-			qas := buildAnswer(results)
-			if len(qas) > 0 {
+			sessionId := context.GetHeader(sessionHeader)
+			if len(sessionId) == 0 {
+				sessionId = context.Query("session_id")
+			}
+			if len(sessionId) == 0 {
+				sessionId = stringx.RandId()
+			}
+			context.Header(sessionHeader, sessionId)
+			// the other query parameters are accessible to the answer templates
+			params := make(map[string]string)
+			for key, values := range context.Request.URL.Query() {
+				switch key {
+				case "q", "p", "qus_type", "session_id", "trace":
+				default:
+					params[key] = values[0]
+				}
+			}
+			// trace=true explains how the question is answered, for debugging
+			trace, _ := strconv.ParseBool(context.Query("trace"))
+			var response bot.Response
+			if trace {
+				response = chatbot.ConverseWithTrace(sessionId, q, params)
+			} else {
+				response = chatbot.Converse(sessionId, q, params)
+			}
+			qas := buildAnswer(response.Answers)
+			if len(qas) > 0 && len(qas[0].Question) > 0 {
 				feedback := bot.Feedback{
+					Project:  p,
 					Question: q,
 					Answer:   qas[0].Answer,
 					Cid:      qas[0].ID,
 				}
+				// the answers of the rules and the conversations have no corpus
+				// to give feedback on, but they are answered
+				if qas[0].ID <= 0 {
+					feedback.Resolved = 1
+				}
+				chatbot.AddFeedbackToDB(&feedback)
+			} else if len(response.Suggestions) > 0 {
+				qas = buildAnswer(response.Suggestions)
+				for i := range qas {
+					qas[i].Suggested = true
+				}
+				// the suggestions are not answers, the question is unanswered
+				feedback := bot.Feedback{
+					Project:  p,
+					Question: q,
+					Cid:      0,
+				}
 				chatbot.AddFeedbackToDB(&feedback)
 			} else {
-				answer := "对不起，没有找答案,请详细描述你的问题（文字不少于15个汉字），\n我们会自动收集你的问题并进行反馈，谢谢！！"
+				answer := noAnswerReply
 				if len(q) > 45 {
-					answer = "对不起，没有找答案,你的问题我已经记录并反馈，无需重复提交，谢谢！！！。"
+					answer = recordedReply
 					feedback := bot.Feedback{
+						Project:  p,
 						Question: q,
 						Answer:   "",
 						Cid:      0,
 					}
 					chatbot.AddFeedbackToDB(&feedback)
 				}
+				if len(chatbot.Config.DefaultReply) > 0 {
+					answer = chatbot.Config.DefaultReply
+				}
+				if len(qas) > 0 {
+					answer = qas[0].Answer
+				}
 				qa := QA{
 					Answer:   answer,
 					Question: q,
 				}
-				qas = append(qas, qa)
+				qas = []QA{qa}
+			}
+			for i := range qas {
+				qas[i].DidYouMean = response.DidYouMean
+			}
+			if trace {
+				data = map[string]interface{}{
+					"answers": qas,
+					"trace":   response.Trace,
+				}
+			} else {
+				data = qas
 			}
-			data = qas
 		}
 	})
 
@@ -350,7 +463,6 @@ func bindRounter(router *gin.Engine) {
 		if err != nil {
 			return
 		}
-		chatbot.StorageAdapter.BuildIndex()
 	})
 
 	v1.GET("list/project", func(context *gin.Context) {
@@ -362,6 +474,98 @@ func bindRounter(router *gin.Engine) {
 		})
 	})
 
+	v1.GET("list/synonym", func(context *gin.Context) {
+		var (
+			data interface{}
+			err  error
+		)
+		defer HandlerResult(context, &data, &err)
+		p := context.Query("p")
+		if p == "" {
+			p = *project
+		}
+		var chatbot *bot.ChatBot
+		if chatbot, _ = factory.GetChatBot(p); chatbot == nil {
+			err = fmt.Errorf("project '%s' not found", p)
+			return
+		}
+		data, err = chatbot.ListSynonyms()
+	})
+
+	v1.POST("synonym/add", func(context *gin.Context) {
+		var (
+			data interface{}
+			err  error
+		)
+		defer HandlerResult(context, &data, &err)
+		var synonym bot.Synonym
+		context.Bind(&synonym)
+		var chatbot *bot.ChatBot
+		if chatbot, _ = factory.GetChatBot(synonym.Project); chatbot == nil {
+			err = fmt.Errorf("project '%s' not found", synonym.Project)
+			return
+		}
+		err = chatbot.AddSynonymToDB(&synonym)
+		data = synonym
+	})
+
+	v1.POST("synonym/remove", func(context *gin.Context) {
+		var (
+			data interface{}
+			err  error
+		)
+		defer HandlerResult(context, &data, &err)
+		var synonym bot.Synonym
+		context.Bind(&synonym)
+		var chatbot *bot.ChatBot
+		if chatbot, _ = factory.GetChatBot(synonym.Project); chatbot == nil {
+			err = fmt.Errorf("project '%s' not found", synonym.Project)
+			return
+		}
+		err = chatbot.RemoveSynonymFromDB(synonym.Id)
+	})
+
+	v1.GET("unanswered", func(context *gin.Context) {
+		var (
+			data interface{}
+			err  error
+		)
+		defer HandlerResult(context, &data, &err)
+		p := context.Query("p")
+		if p == "" {
+			p = *project
+		}
+		var chatbot *bot.ChatBot
+		if chatbot, _ = factory.GetChatBot(p); chatbot == nil {
+			err = fmt.Errorf("project '%s' not found", p)
+			return
+		}
+		// the clusters are mined periodically, refresh=true to mine them now
+		if refresh, _ := strconv.ParseBool(context.Query("refresh")); refresh {
+			data, err = chatbot.MineUnanswered()
+		} else {
+			data, err = chatbot.UnansweredClusters()
+		}
+	})
+
+	v1.POST("unanswered/resolve", func(context *gin.Context) {
+		var (
+			data interface{}
+			err  error
+		)
+		defer HandlerResult(context, &data, &err)
+		var resolution bot.ClusterResolution
+		if err = context.Bind(&resolution); err != nil {
+			return
+		}
+		var chatbot *bot.ChatBot
+		if chatbot, _ = factory.GetChatBot(resolution.Project); chatbot == nil {
+			err = fmt.Errorf("project '%s' not found", resolution.Project)
+			return
+		}
+		data, err = chatbot.ResolveUnanswered(resolution)
+	})
+
 	v1.POST("list/corpus", func(context *gin.Context) {
 		var corpus bot.Corpus
 		var start int
@@ -466,10 +670,41 @@ func bindRounter(router *gin.Engine) {
 		if err != nil {
 			return
 		}
+		if q := feedbackQuestion(context, req); len(q) > 0 {
+			// the questions are logged with question marks by search
+			if !strings.HasSuffix(q, "?") && !strings.HasSuffix(q, "？") {
+				q = q + "?"
+			}
+			err = factory.UpdateFeedbackCounter(req.Id, q, req.IsOk)
+		}
 	})
 
 }
 
+// feedbackQuestion returns the question of the feedback, the one posted, or
+// else the last question of the session that the corpus answered.
+func feedbackQuestion(context *gin.Context, req ResoveReq) string {
+	if len(req.Question) > 0 {
+		return req.Question
+	}
+
+	sessionId := context.GetHeader(sessionHeader)
+	if len(sessionId) == 0 {
+		sessionId = req.SessionId
+	}
+	p := req.Project
+	if p == "" {
+		p = *project
+	}
+	chatbot, ok := factory.GetChatBot(p)
+	if !ok {
+		return ""
+	}
+
+	question, _ := chatbot.AnsweredQuestion(sessionId, req.Id)
+	return question
+}
+
 //var boundary = "\n\u001b[38;5;21m#--------------------------------#\u001b[0m\n"
 var colorPre = "\u001B[38;5;15m\u001B[48;5;88m"
 var colorBehind = "\u001b[0m"
@@ -559,7 +794,7 @@ func Cors() gin.HandlerFunc {
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length", "Authorization", "Content-Type"},
+		ExposeHeaders:    []string{"Content-Length", "Authorization", "Content-Type", sessionHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	},
@@ -568,6 +803,7 @@ func Cors() gin.HandlerFunc {
 
 //go:generate packr
 func main() {
+	flag.Parse()
 	factory = bot.NewChatBotFactory(bot.Config{
 		Driver:     *driver,
 		DataSource: *datasource,
@@ -580,8 +816,14 @@ func main() {
 	_ = box
 	//router.StaticFS("/static", http.FileSystem(box))
 	router.StaticFS("/static", http.Dir("./static"))
+	var err error
+	if assets, err = rich.NewAssetStore(*assetDir, assetPrefix); err != nil {
+		logger.Error(err)
+		return
+	}
+	router.Static(assetPrefix, assets.Dir())
 	bindRounter(router)
-	err := router.Run(*bind)
+	err = router.Run(*bind)
 	if err != nil {
 		logger.Error(err)
 		return
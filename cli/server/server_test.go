@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-xorm/xorm"
+	"github.com/kevwan/chatbot/bot"
+	"github.com/kevwan/chatbot/bot/adapters/logic"
+	"github.com/kevwan/chatbot/bot/session"
+)
+
+type stubMatch []logic.Answer
+
+func (match stubMatch) CanProcess(string) bool {
+	return true
+}
+
+func (match stubMatch) Process(string) []logic.Answer {
+	return append([]logic.Answer(nil), match...)
+}
+
+func (match stubMatch) SetVerbose() {
+}
+
+// dataSource is shared by the tests, since the engine of bot is created once.
+var dataSource string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "chatbot-server")
+	if err != nil {
+		panic(err)
+	}
+	dataSource = filepath.Join(dir, "chatbot.db")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func useTestFactory(t *testing.T) *xorm.Engine {
+	gin.SetMode(gin.TestMode)
+	factory = bot.NewChatBotFactory(bot.Config{
+		Driver:     "sqlite3",
+		DataSource: dataSource,
+	})
+	factory.Init()
+
+	db, err := xorm.NewEngine("sqlite3", dataSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func TestFeedbackResolvesQuestionBySession(t *testing.T) {
+	db := useTestFactory(t)
+	corpus := bot.Corpus{Project: "test", Question: "how to restart the server", Answer: "make restart"}
+	if _, err := db.Insert(&corpus); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := session.NewMemoryStore("session-feedback-test", time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory.AddChatBot("test", &bot.ChatBot{
+		LogicAdapter: stubMatch{{
+			Content:    corpus.Answer,
+			Question:   corpus.Question,
+			CorpusId:   corpus.Id,
+			Confidence: 1,
+		}},
+		Sessions: sessions,
+		Config:   bot.Config{Project: "test"},
+	})
+
+	router := gin.New()
+	bindRounter(router)
+
+	search := httptest.NewRequest(http.MethodGet, "/api/v1/search?p=test&q="+url.QueryEscape("restart it"), nil)
+	search.Header.Set(sessionHeader, "session")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, search)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("search failed with %d", recorder.Code)
+	}
+
+	// the client posts the corpus id only, like the bundled pages
+	feedback := httptest.NewRequest(http.MethodPost, "/api/v1/feedback",
+		strings.NewReader(`{"id": 1, "is_ok": true, "project": "test"}`))
+	feedback.Header.Set("Content-Type", "application/json")
+	feedback.Header.Set(sessionHeader, "session")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, feedback)
+	if !strings.Contains(recorder.Body.String(), `"code":0`) {
+		t.Fatalf("feedback failed: %s", recorder.Body.String())
+	}
+
+	var rows []bot.Feedback
+	if err := db.Where("cid = ?", corpus.Id).Find(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Question != "restart it?" || rows[0].AcceptCount != 1 {
+		t.Fatalf("expected the accept counted on the question asked in the session, got %+v", rows)
+	}
+
+	// without the session, there's no question to learn
+	feedback = httptest.NewRequest(http.MethodPost, "/api/v1/feedback",
+		strings.NewReader(`{"id": 1, "is_ok": false, "project": "test"}`))
+	feedback.Header.Set("Content-Type", "application/json")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, feedback)
+	rows = nil
+	if err := db.Where("cid = ?", corpus.Id).Find(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].RejectCount != 0 {
+		t.Fatalf("expected no question resolved without the session, got %+v", rows)
+	}
+}
+
+func TestSearchLogsTheAnswersWithoutCorpus(t *testing.T) {
+	db := useTestFactory(t)
+
+	// the answers of the rules have a question but no corpus
+	factory.AddChatBot("rules", &bot.ChatBot{
+		LogicAdapter: stubMatch{{
+			Content:    "hello",
+			Question:   "hi",
+			Confidence: 1,
+		}},
+		Config: bot.Config{Project: "rules"},
+	})
+	factory.AddChatBot("empty", &bot.ChatBot{
+		LogicAdapter: stubMatch{},
+		Config:       bot.Config{Project: "empty", DefaultReply: "ask the admin"},
+	})
+
+	router := gin.New()
+	bindRounter(router)
+
+	search := func(project, question string) string {
+		request := httptest.NewRequest(http.MethodGet,
+			"/api/v1/search?p="+project+"&q="+url.QueryEscape(question), nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("search failed with %d", recorder.Code)
+		}
+		return recorder.Body.String()
+	}
+
+	search("rules", "hi there")
+	var rows []bot.Feedback
+	if err := db.Where("question = ?", "hi there?").Find(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Project != "rules" || rows[0].Resolved != 1 {
+		t.Fatalf("expected the answer logged as resolved in its project, got %+v", rows)
+	}
+
+	if body := search("empty", "anything"); !strings.Contains(body, "ask the admin") {
+		t.Fatalf("expected the default reply of the project, got %s", body)
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"path/filepath"
 	"strings"
@@ -19,11 +21,29 @@ var (
 	corpora       = flag.String("i", "", "the corpora files, comma to separate multiple files")
 	storeFile     = flag.String("o", "corpus.gob", "the file to store corpora")
 	printMemStats = flag.Bool("m", false, "enable printing memory stats")
+	check         = flag.String("check", "", "verify the given store file and print its header")
+	corpusIdf     = flag.Bool("idf", false, "weight the keywords by the IDFs learned from the corpora")
+	routing       = flag.String("routing", "", "print the questions of the given store file that are routed differently when asked")
+	rules         = flag.String("rules", "", "the JSON file of the classifier rules to tell the questions by")
 )
 
 func main() {
 	flag.Parse()
 
+	if len(*check) > 0 {
+		header, err := storage.ReadStoreHeader(*check)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(header)
+		return
+	}
+
+	if len(*routing) > 0 {
+		printRoutingMismatches(*routing)
+		return
+	}
+
 	var files []string
 	if len(*dir) > 0 {
 		files = findCorporaFiles(*dir)
@@ -44,10 +64,12 @@ func main() {
 		return
 	}
 
-	store, err := storage.NewSeparatedMemoryStorage(*storeFile)
+	store, err := storage.NewSeparatedMemoryStorage(*storeFile, *project)
 	if err != nil {
 		log.Fatal(err)
 	}
+	store.SetClassifier(loadClassifier(*rules))
+	store.SetCorpusIdf(*corpusIdf)
 
 	chatbot := &bot.ChatBot{
 		PrintMemStats:  *printMemStats,
@@ -72,6 +94,50 @@ func main() {
 	}
 }
 
+func printRoutingMismatches(file string) {
+	store, err := storage.NewSeparatedMemoryStorage(file, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	store.SetClassifier(loadClassifier(*rules))
+
+	mismatches := store.RoutingMismatches()
+	for _, mismatch := range mismatches {
+		stored := "declarative"
+		if mismatch.Question {
+			stored = "question"
+		}
+		fmt.Printf("%s (%s): %s\n", mismatch.Sentence, stored, strings.Join(mismatch.Phrasings, " | "))
+	}
+	fmt.Printf("%d of %d sentences are routed differently when asked, consider search_both\n",
+		len(mismatches), store.Count())
+}
+
+// loadClassifier loads the rule classifier from the JSON file of the rules, or
+// returns nil for the default classifier if there's no file.
+func loadClassifier(file string) storage.Classifier {
+	if len(file) == 0 {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var classifierRules []storage.ClassifierRule
+	if err := json.Unmarshal(content, &classifierRules); err != nil {
+		log.Fatalf("%s: %v", file, err)
+	}
+
+	classifier, err := storage.NewRuleClassifier(classifierRules, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return classifier
+}
+
 func findCorporaFiles(dir string) []string {
 	var files []string
 